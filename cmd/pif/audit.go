@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"prompt-injection-firewall/internal/audit"
+	"prompt-injection-firewall/internal/config"
+)
+
+// auditKeyEnv names the environment variable holding the audit chain key.
+// It is kept out of config.yaml so that reading the config is not enough to
+// rebuild the chain.
+const auditKeyEnv = "PIF_AUDIT_KEY"
+
+func auditKey() []byte {
+	return []byte(os.Getenv(auditKeyEnv))
+}
+
+type anchorList []audit.Anchor
+
+func (a *anchorList) String() string {
+	parts := make([]string, 0, len(*a))
+	for _, anchor := range *a {
+		parts = append(parts, fmt.Sprintf("%d:%s", anchor.Seq, anchor.Hash))
+	}
+	return strings.Join(parts, ",")
+}
+
+func (a *anchorList) Set(value string) error {
+	seq, hash, ok := strings.Cut(value, ":")
+	n, err := strconv.ParseUint(seq, 10, 64)
+	if !ok || err != nil || n == 0 || hash == "" {
+		return fmt.Errorf("anchor must be seq:hash, got %q", value)
+	}
+	*a = append(*a, audit.Anchor{Seq: n, Hash: hash})
+	return nil
+}
+
+func runAudit(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] != "verify" {
+		fmt.Fprintln(stderr, "usage: pif audit verify [-config file] [-anchor seq:hash] [-allow-pruned] [-json] [audit.jsonl]")
+		return 2
+	}
+	flags := flag.NewFlagSet("audit verify", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	configPath := flags.String("config", "config.yaml", "Config file naming the audit log when no file is given")
+	asJSON := flags.Bool("json", false, "Print the report as JSON")
+	pruned := flags.Bool("allow-pruned", false, "Accept a chain that starts after seq 1 because retention removed older segments")
+	var anchors anchorList
+	flags.Var(&anchors, "anchor", "Previously recorded seq:hash that must still be present (repeatable)")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+	path := flags.Arg(0)
+	if path == "" {
+		cfg, err := config.Load(*configPath)
+		if err != nil {
+			fmt.Fprintf(stderr, "failed to load config: %v\n", err)
+			return 2
+		}
+		path = cfg.AuditLogPath
+	}
+	files, err := auditFiles(path)
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to list audit segments: %v\n", err)
+		return 2
+	}
+	verifier := &audit.Verifier{Anchors: anchors, Pruned: *pruned, Key: auditKey()}
+	for _, name := range files {
+		check := func(r io.Reader) error {
+			return verifier.Check(name, r)
+		}
+		if err := readFile(name, check); err != nil {
+			fmt.Fprintf(stderr, "failed to read audit log: %v\n", err)
+			return 2
+		}
+	}
+	report := verifier.Report()
+
+	if *asJSON {
+		data, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Fprintln(stdout, string(data))
+	} else {
+		fmt.Fprintf(stdout, "%s: %d events in %d file(s), seq %d-%d, head %s\n", path, report.Events, len(files), report.FirstSeq, report.LastSeq, report.Head)
+		if len(verifier.Key) == 0 {
+			fmt.Fprintf(stdout, "unkeyed check (%s not set): detects accidental damage, not a rewritten chain\n", auditKeyEnv)
+		}
+		if report.Legacy > 0 {
+			fmt.Fprintf(stdout, "%d unchained events before the chain start\n", report.Legacy)
+		}
+		for _, problem := range report.Problems {
+			if problem.Line == 0 {
+				fmt.Fprintln(stdout, problem.Message)
+				continue
+			}
+			fmt.Fprintf(stdout, "%s:%d: %s\n", problem.File, problem.Line, problem.Message)
+		}
+		if report.OK() {
+			fmt.Fprintln(stdout, "OK")
+		} else {
+			fmt.Fprintf(stdout, "FAILED: %d problem(s)\n", len(report.Problems))
+		}
+	}
+	if !report.OK() {
+		return 1
+	}
+	return 0
+}
+
+func auditFiles(path string) ([]string, error) {
+	files, err := audit.Segments(path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(path); err == nil || len(files) == 0 {
+		files = append(files, path)
+	}
+	return files, nil
+}
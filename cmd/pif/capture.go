@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+
+	"prompt-injection-firewall/internal/capture"
+	"prompt-injection-firewall/internal/config"
+)
+
+type exchangeView struct {
+	Status int         `json:"status,omitempty"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body"`
+}
+
+type forensicView struct {
+	capture.Forensic
+	Request  exchangeView  `json:"request"`
+	Response *exchangeView `json:"response,omitempty"`
+}
+
+func runCapture(args []string, stdout, stderr io.Writer) int {
+	if len(args) > 0 {
+		switch args[0] {
+		case "keygen":
+			return runCaptureKeygen(args[1:], stdout, stderr)
+		case "show":
+			return runCaptureShow(args[1:], stdout, stderr)
+		}
+	}
+	fmt.Fprintln(stderr, "usage: pif capture keygen [-out file] | pif capture show -key file [-config file] [-dir dir] [-json] id ...")
+	return 2
+}
+
+func runCaptureKeygen(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("capture keygen", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	out := flags.String("out", "", "Write the secret key to this file instead of stdout")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	secret, public, err := capture.GenerateKey()
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to generate key: %v\n", err)
+		return 2
+	}
+	keyFile := fmt.Sprintf("# public key: %s\n%s\n", public, secret)
+	if *out == "" {
+		fmt.Fprint(stdout, keyFile)
+		return 0
+	}
+	file, err := os.OpenFile(*out, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to write key: %v\n", err)
+		return 2
+	}
+	_, err = file.WriteString(keyFile)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to write key: %v\n", err)
+		return 2
+	}
+	fmt.Fprintf(stdout, "public key: %s\n", public)
+	return 0
+}
+
+func runCaptureShow(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("capture show", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	configPath := flags.String("config", "config.yaml", "Config file naming the capture dir when -dir is not given")
+	dir := flags.String("dir", "", "Capture directory (default: capture.dir from the config)")
+	keyPath := flags.String("key", "", "Secret key file from pif capture keygen")
+	asJSON := flags.Bool("json", false, "Print captures as JSON")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *keyPath == "" || flags.NArg() == 0 {
+		fmt.Fprintln(stderr, "usage: pif capture show -key file [-config file] [-dir dir] [-json] id ...")
+		return 2
+	}
+	data, err := os.ReadFile(*keyPath)
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to read key: %v\n", err)
+		return 2
+	}
+	key, err := capture.ParseSecretKey(string(data))
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to read key: %v\n", err)
+		return 2
+	}
+	if *dir == "" {
+		cfg, err := config.Load(*configPath)
+		if err != nil {
+			fmt.Fprintf(stderr, "failed to load config: %v\n", err)
+			return 2
+		}
+		*dir = cfg.Capture.Dir
+	}
+
+	status := 0
+	for _, id := range flags.Args() {
+		f, err := capture.Load(*dir, id, key)
+		if err != nil {
+			fmt.Fprintf(stderr, "capture %s: %v\n", id, err)
+			status = 2
+			continue
+		}
+		if *asJSON {
+			data, _ := json.MarshalIndent(newForensicView(f), "", "  ")
+			fmt.Fprintln(stdout, string(data))
+			continue
+		}
+		printForensic(stdout, f)
+	}
+	return status
+}
+
+func newForensicView(f capture.Forensic) forensicView {
+	view := forensicView{
+		Forensic: f,
+		Request:  exchangeView{Header: f.Request.Header, Body: string(f.Request.Body)},
+	}
+	if f.Response != nil {
+		view.Response = &exchangeView{Status: f.Response.Status, Header: f.Response.Header, Body: string(f.Response.Body)}
+	}
+	return view
+}
+
+func printForensic(w io.Writer, f capture.Forensic) {
+	fmt.Fprintf(w, "capture %s at %s: %s stage, %s", f.ID, f.Time.Format("2006-01-02T15:04:05Z07:00"), f.Stage, f.Decision)
+	if f.RuleName != "" {
+		fmt.Fprintf(w, " by %s", f.RuleName)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "\n%s %s\n", f.Method, f.Path)
+	printExchange(w, f.Request)
+	if f.Response != nil {
+		fmt.Fprintf(w, "\nHTTP %d\n", f.Response.Status)
+		printExchange(w, *f.Response)
+	}
+}
+
+func printExchange(w io.Writer, e capture.Exchange) {
+	names := make([]string, 0, len(e.Header))
+	for name := range e.Header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range e.Header[name] {
+			fmt.Fprintf(w, "%s: %s\n", name, value)
+		}
+	}
+	fmt.Fprintf(w, "\n%s\n", e.Body)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"prompt-injection-firewall/internal/config"
+	"prompt-injection-firewall/internal/policy"
+	"prompt-injection-firewall/internal/proxy"
+)
+
+type evalResult struct {
+	File string `json:"file"`
+	proxy.Verdict
+}
+
+func runEval(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("eval", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	configPath := flags.String("config", "config.yaml", "Path to config file")
+	stage := flags.String("stage", "request", "Policy stage: request or response")
+	path := flags.String("path", "/v1/chat/completions", "Request path used to pick the route format")
+	asJSON := flags.Bool("json", false, "Print one JSON object per input")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: pif eval [-config file] [-stage request|response] [-path /v1/...] [-json] [file ...|-]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *stage != "request" && *stage != "response" {
+		fmt.Fprintf(stderr, "unknown stage %q\n", *stage)
+		return 2
+	}
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to load config: %v\n", err)
+		return 2
+	}
+	evaluator, err := policy.Compile(cfg)
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to load config: %v\n", err)
+		return 2
+	}
+
+	files := flags.Args()
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+	for _, file := range files {
+		body, err := readInput(file, stdin)
+		if err != nil {
+			fmt.Fprintf(stderr, "failed to read %s: %v\n", file, err)
+			return 2
+		}
+		result := evalResult{File: file, Verdict: proxy.Evaluate(cfg, evaluator, *stage, *path, body)}
+		if *asJSON {
+			data, _ := json.Marshal(result)
+			fmt.Fprintln(stdout, string(data))
+			continue
+		}
+		printVerdict(stdout, result)
+	}
+	return 0
+}
+
+func readInput(file string, stdin io.Reader) ([]byte, error) {
+	if file == "-" {
+		return io.ReadAll(stdin)
+	}
+	return os.ReadFile(file)
+}
+
+func printVerdict(w io.Writer, result evalResult) {
+	fmt.Fprintf(w, "%s: %s", result.File, result.Decision)
+	if result.RuleName != "" {
+		fmt.Fprintf(w, " (rule %s)", result.RuleName)
+	}
+	fmt.Fprintln(w)
+	if result.Reason != "" {
+		fmt.Fprintf(w, "  reason: %s\n", result.Reason)
+	}
+	if result.WouldDecision != "" {
+		fmt.Fprintf(w, "  would: %s (rule %s)\n", result.WouldDecision, result.WouldRule)
+	}
+	if len(result.ScoreRules) > 0 {
+		fmt.Fprintf(w, "  score: %g (%s)\n", result.Score, strings.Join(result.ScoreRules, ", "))
+	}
+	fmt.Fprintf(w, "  format: %s\n", result.Format)
+	fmt.Fprintf(w, "  tools: %s\n", strings.Join(result.ToolNames, ", "))
+	fmt.Fprintf(w, "  text: %q\n", result.Text)
+}
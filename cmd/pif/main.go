@@ -1,27 +1,59 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"prompt-injection-firewall/internal/approval"
 	"prompt-injection-firewall/internal/audit"
+	"prompt-injection-firewall/internal/capture"
 	"prompt-injection-firewall/internal/config"
 	"prompt-injection-firewall/internal/policy"
 	"prompt-injection-firewall/internal/proxy"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "audit":
+			os.Exit(runAudit(os.Args[2:], os.Stdout, os.Stderr))
+		case "eval":
+			os.Exit(runEval(os.Args[2:], os.Stdin, os.Stdout, os.Stderr))
+		case "test-policy":
+			os.Exit(runTestPolicy(os.Args[2:], os.Stdout, os.Stderr))
+		case "replay":
+			os.Exit(runReplay(os.Args[2:], os.Stdout, os.Stderr))
+		case "capture":
+			os.Exit(runCapture(os.Args[2:], os.Stdout, os.Stderr))
+		}
+	}
 	configPath := flag.String("config", "config.yaml", "Path to config file")
+	watch := flag.Bool("watch", false, "Reload the config when the file changes")
+	watchInterval := flag.Duration("watch-interval", 2*time.Second, "Polling interval for -watch")
 	flag.Parse()
 
 	cfg, err := config.Load(*configPath)
 	if err != nil {
 		log.Fatalf("failed to load config: %v", err)
 	}
-	logger, err := audit.NewLogger(cfg.AuditLogPath)
+	rotation := cfg.AuditRotation
+	logger, err := audit.NewLogger(cfg.AuditLogPath, audit.WithChainKey(auditKey()), audit.WithRotation(audit.Rotation{
+		MaxBytes:    rotation.MaxBytes,
+		Interval:    rotation.Interval,
+		Compress:    rotation.Compress,
+		MaxSegments: rotation.MaxSegments,
+		MaxAge:      rotation.MaxAge,
+		OnError: func(err error) {
+			log.Printf("audit rotation: %v", err)
+		},
+	}))
 	if err != nil {
 		log.Fatalf("failed to open audit log: %v", err)
 	}
@@ -29,18 +61,89 @@ func main() {
 		_ = logger.Close()
 	}()
 
-	evaluator := policy.NewEvaluator(cfg.Rules, cfg.DecisionOrder)
-	server := proxy.New(cfg, evaluator, logger)
+	store, err := approval.Open(cfg.Approval)
+	if err != nil {
+		log.Fatalf("failed to open approval store: %v", err)
+	}
+	defer func() {
+		_ = store.Close()
+	}()
+
+	opts := []proxy.Option{proxy.WithApprovalStore(store)}
+	if cfg.Replay.CapturePath != "" {
+		bundle, err := capture.Open(cfg.Replay.CapturePath, capture.WithRotation(cfg.Replay.MaxBytes, cfg.Replay.MaxFiles))
+		if err != nil {
+			log.Fatalf("failed to open replay capture: %v", err)
+		}
+		defer func() {
+			_ = bundle.Close()
+		}()
+		opts = append(opts, proxy.WithReplayCapture(bundle))
+		log.Printf("replay capture enabled: %s", cfg.Replay.CapturePath)
+	}
+	if cfg.Capture.Dir != "" {
+		vault, err := capture.NewVault(cfg.Capture.Dir, cfg.Capture.PublicKey)
+		if err != nil {
+			log.Fatalf("failed to open forensic capture: %v", err)
+		}
+		opts = append(opts, proxy.WithForensicCapture(vault))
+		log.Printf("forensic capture enabled: %s (%v, sample rate %g)", cfg.Capture.Dir, cfg.Capture.Decisions, cfg.Capture.SampleRate)
+	}
+
+	evaluator, err := policy.Compile(cfg)
+	if err != nil {
+		log.Fatalf("failed to compile policy: %v", err)
+	}
+	server, err := proxy.New(cfg, evaluator, logger, opts...)
+	if err != nil {
+		log.Fatalf("failed to start proxy: %v", err)
+	}
+	go server.Recover()
+	go server.RunCleanup(context.Background(), time.Minute)
 
 	log.Printf("prompt-injection-firewall listening on %s", cfg.ListenAddr)
 	log.Printf("upstream: %s", cfg.Upstream)
+	log.Printf("policy version: %s", cfg.Version)
 	if cfg.Approval.Enabled {
-		log.Printf("approval endpoint enabled: /approve")
+		log.Printf("approval endpoint enabled: /approve (store: %s)", storeName(cfg.Approval.Store))
 	}
-	if cfg.Approval.Token == "" && cfg.Approval.Enabled {
+	if cfg.Approval.Token == "" && len(cfg.Approval.Approvers) == 0 && cfg.Approval.Enabled {
 		fmt.Fprintln(os.Stderr, "warning: approval endpoint enabled without token")
 	}
 
+	reloaded := func(err error) {
+		if err != nil {
+			log.Printf("config reload failed, keeping policy %s: %v", server.Config().Version, err)
+			return
+		}
+		next := server.Config()
+		log.Printf("config reloaded: policy %s", next.Version)
+		if next.ListenAddr != cfg.ListenAddr || next.AuditLogPath != cfg.AuditLogPath || next.AuditRotation != cfg.AuditRotation || next.Replay != cfg.Replay || next.Capture.Dir != cfg.Capture.Dir || next.Capture.PublicKey != cfg.Capture.PublicKey || next.Approval.Store != cfg.Approval.Store || next.Approval.StorePath != cfg.Approval.StorePath {
+			log.Printf("warning: listen_addr, audit_log_path, audit_rotation, replay, capture dir/key and approval store changes require a restart")
+		}
+	}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			reloaded(server.Reload(*configPath))
+		}
+	}()
+	usr1 := make(chan os.Signal, 1)
+	signal.Notify(usr1, syscall.SIGUSR1)
+	go func() {
+		for range usr1 {
+			if err := logger.Rotate(); err != nil {
+				log.Printf("audit rotation failed: %v", err)
+				continue
+			}
+			log.Printf("audit log rotated")
+		}
+	}()
+	if *watch {
+		go server.WatchConfig(context.Background(), *configPath, *watchInterval, reloaded)
+	}
+
 	httpServer := &http.Server{
 		Addr:    cfg.ListenAddr,
 		Handler: server,
@@ -50,3 +153,10 @@ func main() {
 		log.Fatalf("server error: %v", err)
 	}
 }
+
+func storeName(name string) string {
+	if name == "" {
+		return "memory"
+	}
+	return name
+}
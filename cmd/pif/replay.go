@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"prompt-injection-firewall/internal/audit"
+	"prompt-injection-firewall/internal/capture"
+	"prompt-injection-firewall/internal/config"
+	"prompt-injection-firewall/internal/policy"
+	"prompt-injection-firewall/internal/replay"
+)
+
+func runReplay(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	configPath := flags.String("config", "config.yaml", "Candidate config to replay against")
+	bundlePath := flags.String("bundle", "", "Replay capture file (default: replay.capture_path from the config)")
+	samples := flags.Int("samples", 5, "Request IDs to list per decision change")
+	asJSON := flags.Bool("json", false, "Print the report as JSON")
+	failOnChange := flags.Bool("fail-on-change", false, "Exit 1 if any decision changes")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: pif replay -config new.yaml [-bundle replay.jsonl] [-samples 5] [-json] [-fail-on-change] [audit.jsonl ...]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to load config: %v\n", err)
+		return 2
+	}
+	evaluator, err := policy.Compile(cfg)
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to load config: %v\n", err)
+		return 2
+	}
+	replayer := replay.New(cfg, evaluator, *samples)
+
+	bundle := *bundlePath
+	if bundle == "" {
+		bundle = cfg.Replay.CapturePath
+	}
+	if bundle != "" {
+		bundles, err := capture.Files(bundle)
+		if err != nil {
+			fmt.Fprintf(stderr, "failed to list replay captures: %v\n", err)
+			return 2
+		}
+		if len(bundles) == 0 && *bundlePath != "" {
+			bundles = []string{bundle}
+		}
+		for _, name := range bundles {
+			if err := readFile(name, replayer.LoadBundle); err != nil {
+				fmt.Fprintf(stderr, "failed to read replay capture: %v\n", err)
+				return 2
+			}
+		}
+	}
+	files := flags.Args()
+	if len(files) == 0 {
+		files, err = auditFiles(cfg.AuditLogPath)
+		if err != nil {
+			fmt.Fprintf(stderr, "failed to list audit segments: %v\n", err)
+			return 2
+		}
+	}
+	for _, file := range files {
+		if err := readFile(file, replayer.Check); err != nil {
+			fmt.Fprintf(stderr, "failed to read audit log: %v\n", err)
+			return 2
+		}
+	}
+
+	report := replayer.Report()
+	if *asJSON {
+		data, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Fprintln(stdout, string(data))
+	} else {
+		printReplay(stdout, report)
+	}
+	if *failOnChange && report.Changed > 0 {
+		return 1
+	}
+	return 0
+}
+
+func readFile(name string, fn func(io.Reader) error) error {
+	r, err := audit.OpenSegment(name)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return fn(r)
+}
+
+func printReplay(w io.Writer, report replay.Report) {
+	fmt.Fprintf(w, "replayed %d requests (%d from capture, %d from audit samples), %d changed\n", report.Total, report.FromCapture, report.FromSample, report.Changed)
+	if report.Total == 0 {
+		return
+	}
+	decisions := map[string]bool{}
+	for from, row := range report.Matrix {
+		decisions[from] = true
+		for to := range row {
+			decisions[to] = true
+		}
+	}
+	names := make([]string, 0, len(decisions))
+	for name := range decisions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(w, "\n%-10s", "old\\new")
+	for _, to := range names {
+		fmt.Fprintf(w, "%10s", to)
+	}
+	fmt.Fprintln(w)
+	for _, from := range names {
+		fmt.Fprintf(w, "%-10s", from)
+		for _, to := range names {
+			fmt.Fprintf(w, "%10d", report.Matrix[from][to])
+		}
+		fmt.Fprintln(w)
+	}
+	if len(report.Changes) > 0 {
+		fmt.Fprintln(w)
+	}
+	for _, change := range report.Changes {
+		fmt.Fprintf(w, "%s -> %s (%d): %s\n", change.From, change.To, change.Count, strings.Join(change.RequestIDs, ", "))
+	}
+}
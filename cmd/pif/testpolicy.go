@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+
+	"prompt-injection-firewall/internal/config"
+	"prompt-injection-firewall/internal/policy"
+	"prompt-injection-firewall/internal/policytest"
+)
+
+func runTestPolicy(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("test-policy", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	configPath := flags.String("config", "config.yaml", "Path to config file")
+	asJSON := flags.Bool("json", false, "Print one JSON result per case")
+	verbose := flags.Bool("v", false, "List passing cases too")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: pif test-policy [-config file] [-json] [-v] tests.yaml ...")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to load config: %v\n", err)
+		return 2
+	}
+	evaluator, err := policy.Compile(cfg)
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to load config: %v\n", err)
+		return 2
+	}
+	var cases []policytest.Case
+	for _, file := range flags.Args() {
+		loaded, err := policytest.Load(file)
+		if err != nil {
+			fmt.Fprintf(stderr, "failed to load tests: %v\n", err)
+			return 2
+		}
+		cases = append(cases, loaded...)
+	}
+
+	failed := 0
+	for _, result := range policytest.Run(cfg, evaluator, cases) {
+		if !result.Passed() {
+			failed++
+		}
+		if *asJSON {
+			data, _ := json.Marshal(result)
+			fmt.Fprintln(stdout, string(data))
+			continue
+		}
+		if result.Passed() {
+			if *verbose {
+				fmt.Fprintf(stdout, "PASS %s\n", result.Name)
+			}
+			continue
+		}
+		fmt.Fprintf(stdout, "FAIL %s (%s)\n", result.Name, result.File)
+		for _, diff := range result.Diffs {
+			fmt.Fprintf(stdout, "  %s:\n    - %q\n    + %q\n", diff.Field, diff.Want, diff.Got)
+		}
+		if verdict := result.Verdict; verdict.WouldDecision != "" {
+			fmt.Fprintf(stdout, "  would be %s by %s outside monitor/dry-run\n", verdict.WouldDecision, verdict.WouldRule)
+		}
+	}
+	if !*asJSON {
+		fmt.Fprintf(stdout, "%d passed, %d failed\n", len(cases)-failed, failed)
+	}
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,254 @@
+package approval
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	recordExt  = ".json"
+	tempPrefix = ".tmp-"
+)
+
+type FileStore struct {
+	mu  sync.Mutex
+	dir string
+}
+
+func NewFileStore(dir string) (*FileStore, error) {
+	if dir == "" {
+		return nil, errors.New("approval store_path is required for the file store")
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	s := &FileStore{dir: dir}
+	if err := s.recover(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileStore) Put(req Request) error {
+	if err := checkID(req.ID); err != nil {
+		return err
+	}
+	if req.Status == "" {
+		req.Status = StatusPending
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.writeLocked(req)
+}
+
+func (s *FileStore) Get(id string) (Request, bool, error) {
+	if err := checkID(id); err != nil {
+		return Request{}, false, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.getLocked(id, time.Now())
+}
+
+func (s *FileStore) Update(id string, fn func(*Request) error) (Request, bool, error) {
+	if err := checkID(id); err != nil {
+		return Request{}, false, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	req, ok, err := s.getLocked(id, time.Now())
+	if err != nil || !ok {
+		return Request{}, false, err
+	}
+	if err := fn(&req); err != nil {
+		return req, true, err
+	}
+	if err := s.writeLocked(req); err != nil {
+		return Request{}, false, err
+	}
+	return req, true, nil
+}
+
+func (s *FileStore) List() ([]Request, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	records, err := s.recordsLocked()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	out := make([]Request, 0, len(records))
+	for _, req := range records {
+		if req = req.settle(now); req.Status == StatusPending {
+			out = append(out, req)
+		}
+	}
+	sortByCreated(out)
+	return out, nil
+}
+
+func (s *FileStore) Unresolved() ([]Request, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	records, err := s.recordsLocked()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	var out []Request
+	for _, req := range records {
+		if req.unresolved(now) {
+			out = append(out, req)
+		}
+	}
+	sortByCreated(out)
+	return out, nil
+}
+
+func (s *FileStore) Cleanup(now time.Time) ([]Request, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	records, err := s.recordsLocked()
+	if err != nil {
+		return nil, err
+	}
+	var expired []Request
+	for _, req := range records {
+		if req.Stale(now) {
+			if err := s.removeLocked(s.recordPath(req.ID)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return expired, err
+			}
+			continue
+		}
+		if req.Expired(now) {
+			req = req.settle(now)
+			if err := s.writeLocked(req); err != nil {
+				return expired, err
+			}
+			expired = append(expired, req)
+		}
+	}
+	sortByCreated(expired)
+	return expired, nil
+}
+
+func (s *FileStore) Close() error {
+	return nil
+}
+
+func (s *FileStore) getLocked(id string, now time.Time) (Request, bool, error) {
+	req, err := readRecord(s.recordPath(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return Request{}, false, nil
+	}
+	if err != nil {
+		return Request{}, false, err
+	}
+	if req.Stale(now) {
+		_ = s.removeLocked(s.recordPath(id))
+		return Request{}, false, nil
+	}
+	return req.settle(now), true, nil
+}
+
+func (s *FileStore) recordsLocked() ([]Request, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var out []Request
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, recordExt) || strings.HasPrefix(name, tempPrefix) {
+			continue
+		}
+		req, err := readRecord(filepath.Join(s.dir, name))
+		if err != nil {
+			continue
+		}
+		out = append(out, req)
+	}
+	return out, nil
+}
+
+func (s *FileStore) writeLocked(req Request) error {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(s.dir, tempPrefix+req.ID+"-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName)
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpName, s.recordPath(req.ID)); err != nil {
+		return err
+	}
+	return syncDir(s.dir)
+}
+
+func (s *FileStore) removeLocked(path string) error {
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	return syncDir(s.dir)
+}
+
+func (s *FileStore) recover() error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), tempPrefix) {
+			_ = os.Remove(filepath.Join(s.dir, entry.Name()))
+		}
+	}
+	return syncDir(s.dir)
+}
+
+func (s *FileStore) recordPath(id string) string {
+	return filepath.Join(s.dir, id+recordExt)
+}
+
+func readRecord(path string) (Request, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Request{}, err
+	}
+	var req Request
+	if err := json.Unmarshal(data, &req); err != nil {
+		return Request{}, err
+	}
+	return req, nil
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil && !errors.Is(err, os.ErrInvalid) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package approval
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Grant struct {
+	ID         string    `json:"id"`
+	Session    string    `json:"session,omitempty"`
+	Tools      []string  `json:"tools,omitempty"`
+	Rule       string    `json:"rule,omitempty"`
+	Approver   string    `json:"approver,omitempty"`
+	Roles      []string  `json:"approver_roles,omitempty"`
+	ApprovalID string    `json:"approval_id,omitempty"`
+	Comment    string    `json:"comment,omitempty"`
+	Created    time.Time `json:"created"`
+	Expires    time.Time `json:"expires,omitempty"`
+	MaxUses    int       `json:"max_uses,omitempty"`
+	Uses       int       `json:"uses"`
+}
+
+type Grants struct {
+	mu    sync.Mutex
+	items map[string]Grant
+}
+
+func NewGrants() *Grants {
+	return &Grants{items: make(map[string]Grant)}
+}
+
+func (g Grant) Live(now time.Time) bool {
+	if !g.Expires.IsZero() && now.After(g.Expires) {
+		return false
+	}
+	return g.MaxUses == 0 || g.Uses < g.MaxUses
+}
+
+func (g Grant) Covers(session, rule string, tools []string) bool {
+	if g.Session != "" && g.Session != session {
+		return false
+	}
+	if g.Rule != "" && g.Rule != rule {
+		return false
+	}
+	if len(g.Tools) > 0 {
+		if len(tools) == 0 {
+			return false
+		}
+		for _, tool := range tools {
+			if !containsFold(g.Tools, tool) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Satisfies reports whether the approver behind the grant holds one of
+// the roles a rule requires.
+func (g Grant) Satisfies(roles []string) bool {
+	if len(roles) == 0 {
+		return true
+	}
+	for _, role := range roles {
+		if containsFold(g.Roles, role) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Grants) Add(grant Grant) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items[grant.ID] = grant
+}
+
+func (s *Grants) Use(session, rule string, tools, roles []string, now time.Time) (Grant, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, grant := range s.liveLocked(now) {
+		if !grant.Covers(session, rule, tools) || !grant.Satisfies(roles) {
+			continue
+		}
+		grant.Uses++
+		s.items[grant.ID] = grant
+		return grant, true
+	}
+	return Grant{}, false
+}
+
+func (s *Grants) List(now time.Time) []Grant {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.liveLocked(now)
+}
+
+func (s *Grants) Revoke(id string) (Grant, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	grant, ok := s.items[id]
+	delete(s.items, id)
+	return grant, ok
+}
+
+func (s *Grants) liveLocked(now time.Time) []Grant {
+	out := make([]Grant, 0, len(s.items))
+	for id, grant := range s.items {
+		if !grant.Live(now) {
+			delete(s.items, id)
+			continue
+		}
+		out = append(out, grant)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Created.Before(out[j].Created)
+	})
+	return out
+}
+
+func containsFold(items []string, value string) bool {
+	for _, item := range items {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+package approval
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGrantsMatchScopeAndExpire(t *testing.T) {
+	now := time.Now()
+	grants := NewGrants()
+	grants.Add(Grant{ID: "tools", Tools: []string{"file_write", "shell"}, Created: now, Expires: now.Add(time.Minute)})
+	grants.Add(Grant{ID: "rule", Rule: "approve_tools", Session: "agent-1", Created: now.Add(time.Second), MaxUses: 1})
+
+	if _, ok := grants.Use("agent-2", "approve_tools", []string{"file_write", "browser"}, nil, now); ok {
+		t.Fatal("expected tool outside the grant to need approval")
+	}
+	if _, ok := grants.Use("agent-2", "approve_tools", nil, nil, now); ok {
+		t.Fatal("expected tool grant not to cover requests without tools")
+	}
+	grant, ok := grants.Use("agent-2", "other", []string{"FILE_WRITE"}, nil, now)
+	if !ok || grant.ID != "tools" || grant.Uses != 1 {
+		t.Fatalf("expected tool grant to match, got %+v %v", grant, ok)
+	}
+	if grant, ok = grants.Use("agent-1", "approve_tools", nil, nil, now); !ok || grant.ID != "rule" {
+		t.Fatalf("expected rule grant to match, got %+v %v", grant, ok)
+	}
+	if _, ok = grants.Use("agent-1", "approve_tools", nil, nil, now); ok {
+		t.Fatal("expected single-use grant to be spent")
+	}
+	if _, ok = grants.Use("agent-2", "other", []string{"shell"}, nil, now.Add(2*time.Minute)); ok {
+		t.Fatal("expected expired grant not to match")
+	}
+	if live := grants.List(now.Add(2 * time.Minute)); len(live) != 0 {
+		t.Fatalf("expected no live grants, got %+v", live)
+	}
+}
+
+func TestGrantsRequireRuleRoles(t *testing.T) {
+	now := time.Now()
+	grants := NewGrants()
+	grants.Add(Grant{ID: "dev", Session: "agent-1", Roles: []string{"dev"}, Created: now, MaxUses: 5})
+
+	if _, ok := grants.Use("agent-1", "exec_command", nil, []string{"security"}, now); ok {
+		t.Fatal("expected grant from an approver without the rule's roles to be skipped")
+	}
+	if _, ok := grants.Use("agent-1", "file_write", nil, []string{"DEV", "security"}, now); !ok {
+		t.Fatal("expected grant from an approver with a required role to match")
+	}
+}
@@ -0,0 +1,118 @@
+package approval
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+type MemoryStore struct {
+	mu    sync.Mutex
+	items map[string]Request
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{items: make(map[string]Request)}
+}
+
+func (s *MemoryStore) Put(req Request) error {
+	if err := checkID(req.ID); err != nil {
+		return err
+	}
+	if req.Status == "" {
+		req.Status = StatusPending
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items[req.ID] = req
+	return nil
+}
+
+func (s *MemoryStore) Get(id string) (Request, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.getLocked(id, time.Now())
+}
+
+func (s *MemoryStore) Update(id string, fn func(*Request) error) (Request, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	req, ok, _ := s.getLocked(id, time.Now())
+	if !ok {
+		return Request{}, false, nil
+	}
+	if err := fn(&req); err != nil {
+		return req, true, err
+	}
+	s.items[id] = req
+	return req, true, nil
+}
+
+func (s *MemoryStore) List() ([]Request, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	out := make([]Request, 0, len(s.items))
+	for _, req := range s.items {
+		if req = req.settle(now); req.Status == StatusPending {
+			out = append(out, req)
+		}
+	}
+	sortByCreated(out)
+	return out, nil
+}
+
+func (s *MemoryStore) Unresolved() ([]Request, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	var out []Request
+	for _, req := range s.items {
+		if req.unresolved(now) {
+			out = append(out, req)
+		}
+	}
+	sortByCreated(out)
+	return out, nil
+}
+
+func (s *MemoryStore) Cleanup(now time.Time) ([]Request, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var expired []Request
+	for id, req := range s.items {
+		if req.Stale(now) {
+			delete(s.items, id)
+			continue
+		}
+		if req.Expired(now) {
+			req = req.settle(now)
+			s.items[id] = req
+			expired = append(expired, req)
+		}
+	}
+	sortByCreated(expired)
+	return expired, nil
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+func (s *MemoryStore) getLocked(id string, now time.Time) (Request, bool, error) {
+	req, ok := s.items[id]
+	if !ok {
+		return Request{}, false, nil
+	}
+	if req.Stale(now) {
+		delete(s.items, id)
+		return Request{}, false, nil
+	}
+	return req.settle(now), true, nil
+}
+
+func sortByCreated(items []Request) {
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Created.Before(items[j].Created)
+	})
+}
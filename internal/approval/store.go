@@ -0,0 +1,155 @@
+package approval
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"prompt-injection-firewall/internal/config"
+)
+
+const (
+	StatusPending  = "pending"
+	StatusApproved = "approved"
+	StatusRejected = "rejected"
+	StatusExpired  = "expired"
+)
+
+var (
+	ErrInvalidID  = errors.New("invalid approval id")
+	ErrNotPending = errors.New("approval is not pending")
+)
+
+var validID = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+type Request struct {
+	ID         string      `json:"id"`
+	RequestID  string      `json:"request_id"`
+	Stage      string      `json:"stage,omitempty"`
+	RuleName   string      `json:"rule_name,omitempty"`
+	Reason     string      `json:"reason,omitempty"`
+	ToolNames  []string    `json:"tool_names,omitempty"`
+	TextSample string      `json:"text_sample,omitempty"`
+	Session    string      `json:"session,omitempty"`
+	Method     string      `json:"method"`
+	Path       string      `json:"path"`
+	Header     http.Header `json:"header"`
+	Body       []byte      `json:"body"`
+	Response   *Response   `json:"response,omitempty"`
+	CaptureID  string      `json:"capture_id,omitempty"`
+	Status     string      `json:"status"`
+	Quorum     int         `json:"quorum,omitempty"`
+	Roles      []string    `json:"roles,omitempty"`
+	Votes      []Vote      `json:"votes,omitempty"`
+	Comment    string      `json:"comment,omitempty"`
+	Result     *Response   `json:"result,omitempty"`
+	ResultKey  string      `json:"result_key,omitempty"`
+	Created    time.Time   `json:"created"`
+	Expires    time.Time   `json:"expires"`
+	Decided    time.Time   `json:"decided,omitempty"`
+	Retain     time.Time   `json:"retain"`
+}
+
+type Response struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+}
+
+type Vote struct {
+	Approver string    `json:"approver"`
+	Roles    []string  `json:"roles,omitempty"`
+	Comment  string    `json:"comment,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+type Store interface {
+	Put(req Request) error
+	Get(id string) (Request, bool, error)
+	Update(id string, fn func(*Request) error) (Request, bool, error)
+	List() ([]Request, error)
+	Unresolved() ([]Request, error)
+	Cleanup(now time.Time) ([]Request, error)
+	Close() error
+}
+
+func Open(cfg config.Approval) (Store, error) {
+	switch strings.ToLower(cfg.Store) {
+	case "", "memory":
+		return NewMemoryStore(), nil
+	case "file":
+		return NewFileStore(cfg.StorePath)
+	default:
+		return nil, fmt.Errorf("unknown approval store %q", cfg.Store)
+	}
+}
+
+// HashToken is what the store keeps of the caller's result token, so the
+// token itself never sits in the store or its files.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (r Request) ResultTokenMatches(token string) bool {
+	if r.ResultKey == "" || token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(HashToken(token)), []byte(r.ResultKey)) == 1
+}
+
+// unresolved is an approved request whose outcome was never stored,
+// typically because the process stopped while it was being released.
+func (r Request) unresolved(now time.Time) bool {
+	return r.Status == StatusApproved && r.Result == nil && !r.Stale(now)
+}
+
+func (r Request) Expired(now time.Time) bool {
+	return r.Status == StatusPending && !r.Expires.IsZero() && now.After(r.Expires)
+}
+
+func (r Request) Stale(now time.Time) bool {
+	return !r.Retain.IsZero() && now.After(r.Retain)
+}
+
+func (r Request) Resolved() bool {
+	switch r.Status {
+	case StatusRejected, StatusExpired:
+		return true
+	case StatusApproved:
+		return r.Result != nil
+	}
+	return false
+}
+
+func (r Request) Approvers() []string {
+	names := make([]string, 0, len(r.Votes))
+	for _, vote := range r.Votes {
+		names = append(names, vote.Approver)
+	}
+	return names
+}
+
+func (r Request) settle(now time.Time) Request {
+	if r.Status == "" {
+		r.Status = StatusPending
+	}
+	if r.Expired(now) {
+		r.Status = StatusExpired
+		r.Decided = r.Expires
+	}
+	return r
+}
+
+func checkID(id string) error {
+	if !validID.MatchString(id) {
+		return ErrInvalidID
+	}
+	return nil
+}
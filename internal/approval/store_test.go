@@ -0,0 +1,122 @@
+package approval
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileStoreSurvivesReopen(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	now := time.Now()
+	req := Request{
+		ID:       "abc123",
+		Method:   http.MethodPost,
+		Path:     "/v1/chat",
+		Header:   http.Header{"Content-Type": {"application/json"}},
+		Body:     []byte(`{"messages":[]}`),
+		Response: &Response{Status: http.StatusOK, Body: []byte(`{"ok":true}`)},
+		Created:  now,
+		Expires:  now.Add(time.Minute),
+	}
+	if err := store.Put(req); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	_ = store.Close()
+
+	if err := os.WriteFile(filepath.Join(dir, tempPrefix+"partial"), []byte("{"), 0o600); err != nil {
+		t.Fatalf("write temp: %v", err)
+	}
+	reopened, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("reopen store: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, tempPrefix+"partial")); !os.IsNotExist(err) {
+		t.Fatalf("expected leftover temp file to be removed")
+	}
+	items, err := reopened.List()
+	if err != nil || len(items) != 1 {
+		t.Fatalf("expected one pending request, got %d (%v)", len(items), err)
+	}
+	approve := func(req *Request) error {
+		if req.Status != StatusPending {
+			return ErrNotPending
+		}
+		req.Status = StatusApproved
+		return nil
+	}
+	got, ok, err := reopened.Update("abc123", approve)
+	if err != nil || !ok {
+		t.Fatalf("update: ok=%v err=%v", ok, err)
+	}
+	if string(got.Body) != string(req.Body) || got.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("unexpected request: %+v", got)
+	}
+	if got.Response == nil || string(got.Response.Body) != `{"ok":true}` {
+		t.Fatalf("expected held response to round-trip")
+	}
+	if _, _, err := reopened.Update("abc123", approve); err != ErrNotPending {
+		t.Fatalf("expected second approval to fail, got %v", err)
+	}
+	reopened, err = NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("reopen store: %v", err)
+	}
+	if got, _, _ := reopened.Get("abc123"); got.Status != StatusApproved {
+		t.Fatalf("expected approved status to persist, got %q", got.Status)
+	}
+}
+
+func TestStoresExpireRequests(t *testing.T) {
+	file, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	for name, store := range map[string]Store{"memory": NewMemoryStore(), "file": file} {
+		now := time.Now()
+		if err := store.Put(Request{ID: "old", Created: now.Add(-time.Hour), Expires: now.Add(-time.Minute), Retain: now.Add(time.Hour)}); err != nil {
+			t.Fatalf("%s: put: %v", name, err)
+		}
+		if err := store.Put(Request{ID: "new", Created: now, Expires: now.Add(time.Hour), Retain: now.Add(2 * time.Hour)}); err != nil {
+			t.Fatalf("%s: put: %v", name, err)
+		}
+		if got, ok, _ := store.Get("old"); !ok || got.Status != StatusExpired {
+			t.Fatalf("%s: expected expired status, got %+v", name, got)
+		}
+		if items, _ := store.List(); len(items) != 1 || items[0].ID != "new" {
+			t.Fatalf("%s: expected only the live request to be listed, got %+v", name, items)
+		}
+		expired, err := store.Cleanup(now)
+		if err != nil || len(expired) != 1 || expired[0].ID != "old" {
+			t.Fatalf("%s: unexpected cleanup result %+v (%v)", name, expired, err)
+		}
+		if expired, _ := store.Cleanup(now); len(expired) != 0 {
+			t.Fatalf("%s: expiry must be reported once, got %+v", name, expired)
+		}
+		if _, err := store.Cleanup(now.Add(3 * time.Hour)); err != nil {
+			t.Fatalf("%s: cleanup: %v", name, err)
+		}
+		if _, ok, _ := store.Get("new"); ok {
+			t.Fatalf("%s: expected retained request to be removed", name)
+		}
+	}
+}
+
+func TestFileStoreRejectsInvalidID(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	if err := store.Put(Request{ID: "../escape"}); err != ErrInvalidID {
+		t.Fatalf("expected ErrInvalidID, got %v", err)
+	}
+	if _, _, err := store.Get("../escape"); err != ErrInvalidID {
+		t.Fatalf("expected ErrInvalidID, got %v", err)
+	}
+}
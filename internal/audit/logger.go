@@ -1,58 +1,202 @@
 package audit
 
 import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"io"
 	"os"
 	"sync"
+	"time"
 )
 
 type Logger struct {
-	mu   sync.Mutex
-	file *os.File
+	mu       sync.Mutex
+	path     string
+	file     *os.File
+	size     int64
+	opened   time.Time
+	seq      uint64
+	prev     string
+	key      []byte
+	rotation Rotation
+	maint    sync.Mutex
+	pending  sync.WaitGroup
 }
 
+type Option func(*Logger)
+
 type Event struct {
-	Time        string   `json:"time"`
-	RequestID   string   `json:"request_id"`
-	RemoteAddr  string   `json:"remote_addr"`
-	Method      string   `json:"method"`
-	Path        string   `json:"path"`
-	Decision    string   `json:"decision"`
-	RuleName    string   `json:"rule_name,omitempty"`
-	Reason      string   `json:"reason,omitempty"`
-	TextSample  string   `json:"text_sample,omitempty"`
-	ToolNames   []string `json:"tool_names,omitempty"`
-	Upstream    string   `json:"upstream"`
-	ApprovalID  string   `json:"approval_id,omitempty"`
-	ElapsedMS   int64    `json:"elapsed_ms"`
-	StatusCode  int      `json:"status_code,omitempty"`
-	BytesIn     int      `json:"bytes_in,omitempty"`
-	BytesOut    int      `json:"bytes_out,omitempty"`
-	ErrorString string   `json:"error,omitempty"`
-}
-
-func NewLogger(path string) (*Logger, error) {
-	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	Seq              uint64   `json:"seq,omitempty"`
+	PrevHash         string   `json:"prev_hash,omitempty"`
+	Time             string   `json:"time"`
+	RequestID        string   `json:"request_id"`
+	RemoteAddr       string   `json:"remote_addr"`
+	Method           string   `json:"method"`
+	Path             string   `json:"path"`
+	Stage            string   `json:"stage,omitempty"`
+	Decision         string   `json:"decision"`
+	WouldDecision    string   `json:"would_decision,omitempty"`
+	WouldRule        string   `json:"would_rule,omitempty"`
+	RuleName         string   `json:"rule_name,omitempty"`
+	Reason           string   `json:"reason,omitempty"`
+	Comment          string   `json:"comment,omitempty"`
+	Score            float64  `json:"score,omitempty"`
+	ScoreRules       []string `json:"score_rules,omitempty"`
+	TextSample       string   `json:"text_sample,omitempty"`
+	ToolNames        []string `json:"tool_names,omitempty"`
+	Upstream         string   `json:"upstream"`
+	ApprovalID       string   `json:"approval_id,omitempty"`
+	Approver         string   `json:"approver,omitempty"`
+	ApproverRoles    []string `json:"approver_roles,omitempty"`
+	Approvers        []string `json:"approvers,omitempty"`
+	GrantID          string   `json:"grant_id,omitempty"`
+	CaptureID        string   `json:"capture_id,omitempty"`
+	ElapsedMS        int64    `json:"elapsed_ms"`
+	StatusCode       int      `json:"status_code,omitempty"`
+	BytesIn          int      `json:"bytes_in,omitempty"`
+	BytesOut         int      `json:"bytes_out,omitempty"`
+	ErrorString      string   `json:"error,omitempty"`
+	PolicyVersion    string   `json:"policy_version,omitempty"`
+	CandidateVersion string   `json:"candidate_version,omitempty"`
+}
+
+// WithChainKey makes prev_hash an HMAC-SHA256 under key, so rebuilding the
+// chain after an edit requires the key and not just write access to the log.
+func WithChainKey(key []byte) Option {
+	return func(l *Logger) {
+		l.key = key
+	}
+}
+
+func NewLogger(path string, opts ...Option) (*Logger, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_RDWR, 0o600)
 	if err != nil {
 		return nil, err
 	}
-	return &Logger{file: file}, nil
+	l := &Logger{path: path, file: file, opened: time.Now()}
+	for _, opt := range opts {
+		opt(l)
+	}
+	if err := l.resume(); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *Logger) resume() error {
+	line, partial, err := lastLine(l.file)
+	if err != nil {
+		return err
+	}
+	if partial {
+		if _, err := l.file.Write([]byte{'\n'}); err != nil {
+			return err
+		}
+	}
+	info, err := l.file.Stat()
+	if err != nil {
+		return err
+	}
+	l.size = info.Size()
+	if line == nil {
+		line, err = lastSegmentLine(l.path)
+		if err != nil || line == nil {
+			return err
+		}
+	}
+	var last struct {
+		Seq uint64 `json:"seq"`
+	}
+	_ = json.Unmarshal(line, &last)
+	l.seq = last.Seq
+	l.prev = Sum(l.key, line)
+	return nil
+}
+
+func Hash(line []byte) string {
+	sum := sha256.Sum256(line)
+	return hex.EncodeToString(sum[:])
+}
+
+// Sum is the chain hash of line: Hash without a key, HMAC-SHA256 with one.
+func Sum(key, line []byte) string {
+	if len(key) == 0 {
+		return Hash(line)
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(line)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func lastLine(file *os.File) ([]byte, bool, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, false, err
+	}
+	var tail []byte
+	for end := info.Size(); end > 0; {
+		start := max(end-64*1024, 0)
+		buf := make([]byte, end-start)
+		if _, err := file.ReadAt(buf, start); err != nil && err != io.EOF {
+			return nil, false, err
+		}
+		tail = append(buf, tail...)
+		end = start
+		partial := tail[len(tail)-1] != '\n'
+		cut := bytes.LastIndexByte(tail, '\n')
+		if cut < 0 {
+			if end == 0 {
+				return nil, partial, nil
+			}
+			continue
+		}
+		body := tail[:cut]
+		if i := bytes.LastIndexByte(body, '\n'); i >= 0 {
+			return body[i+1:], partial, nil
+		}
+		if end == 0 {
+			if len(body) == 0 {
+				return nil, partial, nil
+			}
+			return body, partial, nil
+		}
+	}
+	return nil, false, nil
 }
 
 func (l *Logger) Close() error {
 	l.mu.Lock()
-	defer l.mu.Unlock()
-	return l.file.Close()
+	err := l.file.Close()
+	l.mu.Unlock()
+	l.pending.Wait()
+	return err
 }
 
 func (l *Logger) Write(event Event) error {
 	l.mu.Lock()
-	defer l.mu.Unlock()
+	event.Seq, event.PrevHash = l.seq+1, l.prev
 	data, err := json.Marshal(event)
 	if err != nil {
+		l.mu.Unlock()
 		return err
 	}
-	data = append(data, '\n')
-	_, err = l.file.Write(data)
+	var rotated *segment
+	if l.due(int64(len(data))+1, time.Now()) {
+		rotated, err = l.rotateLocked(time.Now())
+		if err != nil {
+			l.report(err)
+		}
+	}
+	n, err := l.file.Write(append(data, '\n'))
+	l.size += int64(n)
+	if err == nil {
+		l.seq, l.prev = event.Seq, Sum(l.key, data)
+	}
+	l.mu.Unlock()
+	l.finish(rotated)
 	return err
 }
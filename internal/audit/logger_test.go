@@ -0,0 +1,196 @@
+package audit
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func writeChain(t *testing.T, path string, events int) {
+	t.Helper()
+	for round := 0; round < 2; round++ {
+		logger, err := NewLogger(path)
+		if err != nil {
+			t.Fatalf("open logger: %v", err)
+		}
+		for i := 0; i < events/2; i++ {
+			if err := logger.Write(Event{RequestID: "req", Decision: "allow"}); err != nil {
+				t.Fatalf("write: %v", err)
+			}
+		}
+		_ = logger.Close()
+	}
+}
+
+func TestLoggerChainsAcrossReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	if err := os.WriteFile(path, []byte(`{"time":"legacy","decision":"allow"}`+"\n"), 0o600); err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+	writeChain(t, path, 4)
+	data, _ := os.ReadFile(path)
+	report, err := Verify(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if !report.OK() || report.Events != 4 || report.Legacy != 1 || report.LastSeq != 4 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	lines := bytes.Split(bytes.TrimSpace(data), []byte("\n"))
+	if report.Head != Hash(lines[len(lines)-1]) {
+		t.Fatalf("head %s does not hash the last line", report.Head)
+	}
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	writeChain(t, path, 6)
+	data, _ := os.ReadFile(path)
+	lines := strings.SplitAfter(string(data), "\n")
+	lines = lines[:len(lines)-1]
+	head, _ := Verify(strings.NewReader(string(data)))
+
+	cases := map[string]struct {
+		content string
+		anchors []Anchor
+		want    string
+	}{
+		"edit":     {strings.Join(lines[:2], "") + strings.Replace(lines[2], "allow", "deny", 1) + strings.Join(lines[3:], ""), nil, "prev_hash"},
+		"gap":      {strings.Join(lines[:2], "") + strings.Join(lines[3:], ""), nil, "expected seq 3"},
+		"head":     {strings.Join(lines[1:], ""), nil, "chain starts at seq 2"},
+		"partial":  {strings.Join(lines[:5], "") + strings.TrimSuffix(lines[5], "\n"), nil, "truncated final line"},
+		"tail":     {strings.Join(lines[:4], ""), []Anchor{{Seq: 6, Hash: head.Head}}, "anchor seq 6 not found"},
+		"edit-end": {strings.Join(lines[:5], "") + strings.Replace(lines[5], "allow", "deny", 1), []Anchor{{Seq: 6, Hash: head.Head}}, "does not match anchor"},
+	}
+	for name, tc := range cases {
+		report, err := Verify(strings.NewReader(tc.content), tc.anchors...)
+		if err != nil {
+			t.Fatalf("%s: verify: %v", name, err)
+		}
+		if report.OK() || !strings.Contains(report.Problems[0].Message, tc.want) {
+			t.Fatalf("%s: expected %q, got %+v", name, tc.want, report.Problems)
+		}
+	}
+}
+
+func TestVerifyKeyedChain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	key := []byte("chain-key")
+	for i := 0; i < 2; i++ {
+		logger, err := NewLogger(path, WithChainKey(key))
+		if err != nil {
+			t.Fatalf("open logger: %v", err)
+		}
+		for j := 0; j < 2; j++ {
+			if err := logger.Write(Event{RequestID: "req", Decision: "allow"}); err != nil {
+				t.Fatalf("write: %v", err)
+			}
+		}
+		_ = logger.Close()
+	}
+	data, _ := os.ReadFile(path)
+	keyed := &Verifier{Key: key}
+	if err := keyed.Check(path, bytes.NewReader(data)); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if report := keyed.Report(); !report.OK() || report.Events != 4 {
+		t.Fatalf("unexpected keyed report: %+v", report)
+	}
+
+	// A chain rebuilt without the key, as an attacker with write access
+	// would, verifies unkeyed but not against the key.
+	forged := filepath.Join(t.TempDir(), "audit.jsonl")
+	writeChain(t, forged, 4)
+	data, _ = os.ReadFile(forged)
+	if report, _ := Verify(bytes.NewReader(data)); !report.OK() {
+		t.Fatalf("expected the rebuilt chain to pass unkeyed: %+v", report)
+	}
+	keyed = &Verifier{Key: key}
+	if err := keyed.Check(forged, bytes.NewReader(data)); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if report := keyed.Report(); report.OK() {
+		t.Fatalf("expected the rebuilt chain to fail keyed verify")
+	}
+}
+
+func TestLoggerRepairsPartialLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	writeChain(t, path, 2)
+	file, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	_, _ = file.WriteString(`{"seq":3,"prev`)
+	_ = file.Close()
+
+	logger, err := NewLogger(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	_ = logger.Write(Event{RequestID: "after-crash"})
+	_ = logger.Close()
+
+	data, _ := os.ReadFile(path)
+	report, _ := Verify(bytes.NewReader(data))
+	if len(report.Problems) != 1 || report.Problems[0].Line != 3 || report.LastSeq != 3 {
+		t.Fatalf("expected only the torn line to be reported, got %+v", report)
+	}
+}
+
+func TestLoggerRotatesAndChainsAcrossSegments(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	rotation := Rotation{MaxBytes: 400, Compress: true, MaxSegments: 3}
+	logger, err := NewLogger(path, WithRotation(rotation))
+	if err != nil {
+		t.Fatalf("open logger: %v", err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				_ = logger.Write(Event{RequestID: "req", Decision: "allow"})
+			}
+		}()
+	}
+	wg.Wait()
+	if err := logger.Rotate(); err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	_ = logger.Close()
+
+	logger, err = NewLogger(path, WithRotation(rotation))
+	if err != nil {
+		t.Fatalf("reopen logger: %v", err)
+	}
+	_ = logger.Write(Event{RequestID: "after-restart"})
+	_ = logger.Close()
+
+	names, err := Segments(path)
+	if err != nil {
+		t.Fatalf("segments: %v", err)
+	}
+	if len(names) != 3 {
+		t.Fatalf("expected retention to keep 3 segments, got %v", names)
+	}
+	verifier := &Verifier{Pruned: true}
+	for _, name := range append(names, path) {
+		if filepath.Ext(name) != ".gz" && name != path {
+			t.Fatalf("expected compressed segment, got %s", name)
+		}
+		r, err := OpenSegment(name)
+		if err != nil {
+			t.Fatalf("open %s: %v", name, err)
+		}
+		if err := verifier.Check(name, r); err != nil {
+			t.Fatalf("check %s: %v", name, err)
+		}
+		_ = r.Close()
+	}
+	report := verifier.Report()
+	if !report.OK() || report.LastSeq != 41 || report.FirstSeq == 1 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+}
@@ -0,0 +1,243 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const stampFormat = "20060102T150405.000000000Z"
+
+type Rotation struct {
+	MaxBytes    int64
+	Interval    time.Duration
+	Compress    bool
+	MaxSegments int
+	MaxAge      time.Duration
+	OnError     func(error)
+}
+
+type segment struct {
+	file *os.File
+	name string
+}
+
+func WithRotation(rotation Rotation) Option {
+	return func(l *Logger) {
+		l.rotation = rotation
+	}
+}
+
+func (l *Logger) Rotate() error {
+	l.mu.Lock()
+	if l.size == 0 {
+		l.mu.Unlock()
+		return nil
+	}
+	rotated, err := l.rotateLocked(time.Now())
+	l.mu.Unlock()
+	l.finish(rotated)
+	return err
+}
+
+func (l *Logger) due(next int64, now time.Time) bool {
+	if l.size == 0 {
+		return false
+	}
+	if l.rotation.MaxBytes > 0 && l.size+next > l.rotation.MaxBytes {
+		return true
+	}
+	return l.rotation.Interval > 0 && now.Sub(l.opened) >= l.rotation.Interval
+}
+
+// rotateLocked only renames and reopens; syncing, compression and
+// retention run in finish once the logger lock is released.
+func (l *Logger) rotateLocked(now time.Time) (*segment, error) {
+	name := segmentName(l.path, now)
+	if err := os.Rename(l.path, name); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(l.path, os.O_CREATE|os.O_APPEND|os.O_RDWR, 0o600)
+	if err != nil {
+		_ = os.Rename(name, l.path)
+		return nil, err
+	}
+	old := l.file
+	l.file, l.size, l.opened = file, 0, now
+	return &segment{file: old, name: name}, nil
+}
+
+func (l *Logger) finish(rotated *segment) {
+	if rotated == nil {
+		return
+	}
+	l.pending.Add(1)
+	go func() {
+		defer l.pending.Done()
+		l.maint.Lock()
+		defer l.maint.Unlock()
+		_ = rotated.file.Sync()
+		_ = rotated.file.Close()
+		if l.rotation.Compress {
+			if err := compress(rotated.name); err != nil {
+				l.report(err)
+			}
+		}
+		if err := l.prune(time.Now()); err != nil {
+			l.report(err)
+		}
+	}()
+}
+
+func (l *Logger) prune(now time.Time) error {
+	if l.rotation.MaxSegments <= 0 && l.rotation.MaxAge <= 0 {
+		return nil
+	}
+	names, err := Segments(l.path)
+	if err != nil {
+		return err
+	}
+	for i, name := range names {
+		remove := l.rotation.MaxSegments > 0 && len(names)-i > l.rotation.MaxSegments
+		if !remove && l.rotation.MaxAge > 0 {
+			info, err := os.Stat(name)
+			remove = err == nil && now.Sub(info.ModTime()) > l.rotation.MaxAge
+		}
+		if remove {
+			if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (l *Logger) report(err error) {
+	if l.rotation.OnError != nil {
+		l.rotation.OnError(err)
+	}
+}
+
+func compress(name string) error {
+	in, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	tmp := name + ".gz.tmp"
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	_, err = io.Copy(zw, in)
+	if err == nil {
+		err = zw.Close()
+	}
+	if err == nil {
+		err = out.Sync()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, name+".gz")
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return os.Remove(name)
+}
+
+func segmentName(path string, now time.Time) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "-" + now.UTC().Format(stampFormat) + ext
+}
+
+func segmentStamp(path, name string) (string, bool) {
+	ext := filepath.Ext(path)
+	prefix := strings.TrimSuffix(path, ext) + "-"
+	stamp := strings.TrimSuffix(strings.TrimSuffix(name, ".gz"), ext)
+	if !strings.HasPrefix(stamp, prefix) {
+		return "", false
+	}
+	stamp = strings.TrimPrefix(stamp, prefix)
+	if _, err := time.Parse(stampFormat, stamp); err != nil {
+		return "", false
+	}
+	return stamp, true
+}
+
+func Segments(path string) ([]string, error) {
+	ext := filepath.Ext(path)
+	matches, err := filepath.Glob(strings.TrimSuffix(path, ext) + "-*")
+	if err != nil {
+		return nil, err
+	}
+	stamps := map[string]string{}
+	var names []string
+	for _, name := range matches {
+		if stamp, ok := segmentStamp(path, name); ok {
+			stamps[name] = stamp
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return stamps[names[i]] < stamps[names[j]]
+	})
+	return names, nil
+}
+
+func OpenSegment(name string) (io.ReadCloser, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(name, ".gz") {
+		return file, nil
+	}
+	zr, err := gzip.NewReader(file)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{zr, file}, nil
+}
+
+func lastSegmentLine(path string) ([]byte, error) {
+	names, err := Segments(path)
+	if err != nil || len(names) == 0 {
+		return nil, err
+	}
+	r, err := OpenSegment(names[len(names)-1])
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	var last []byte
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 && line[len(line)-1] == '\n' {
+			if trimmed := bytes.TrimSuffix(line, []byte{'\n'}); len(trimmed) > 0 {
+				last = trimmed
+			}
+		}
+		if err == io.EOF {
+			return last, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+type Problem struct {
+	File    string `json:"file,omitempty"`
+	Line    int    `json:"line"`
+	Seq     uint64 `json:"seq,omitempty"`
+	Message string `json:"message"`
+}
+
+type Report struct {
+	Events   int       `json:"events"`
+	Legacy   int       `json:"legacy,omitempty"`
+	FirstSeq uint64    `json:"first_seq,omitempty"`
+	LastSeq  uint64    `json:"last_seq,omitempty"`
+	Head     string    `json:"head,omitempty"`
+	Problems []Problem `json:"problems,omitempty"`
+}
+
+func (r Report) OK() bool {
+	return len(r.Problems) == 0
+}
+
+type Anchor struct {
+	Seq  uint64
+	Hash string
+}
+
+type Verifier struct {
+	Anchors []Anchor
+	Pruned  bool
+	Key     []byte
+	report  Report
+	prev    string
+	found   map[uint64]bool
+}
+
+func Verify(r io.Reader, anchors ...Anchor) (Report, error) {
+	v := &Verifier{Anchors: anchors}
+	if err := v.Check("", r); err != nil {
+		return Report{}, err
+	}
+	return v.Report(), nil
+}
+
+func (v *Verifier) Check(file string, r io.Reader) error {
+	reader := bufio.NewReader(r)
+	for number := 1; ; number++ {
+		line, err := reader.ReadBytes('\n')
+		if len(line) == 0 && err == io.EOF {
+			return nil
+		}
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if err == io.EOF {
+			v.problem(file, number, 0, "truncated final line")
+			return nil
+		}
+		v.line(file, number, bytes.TrimSuffix(line, []byte{'\n'}))
+	}
+}
+
+func (v *Verifier) line(file string, number int, line []byte) {
+	var head struct {
+		Seq      uint64 `json:"seq"`
+		PrevHash string `json:"prev_hash"`
+	}
+	if err := json.Unmarshal(line, &head); err != nil {
+		v.problem(file, number, 0, "invalid JSON")
+		return
+	}
+	if head.Seq == 0 {
+		if v.report.Events == 0 {
+			v.report.Legacy++
+			v.prev = Sum(v.Key, line)
+			return
+		}
+		v.problem(file, number, 0, "event without seq inside the chain")
+		return
+	}
+	pruned := false
+	if v.report.Events == 0 {
+		v.report.FirstSeq = head.Seq
+		pruned = v.Pruned && head.Seq != 1 && v.report.Legacy == 0
+		if head.Seq != 1 && !pruned {
+			v.problem(file, number, head.Seq, fmt.Sprintf("chain starts at seq %d, earlier events are missing", head.Seq))
+		}
+	} else if head.Seq != v.report.LastSeq+1 {
+		v.problem(file, number, head.Seq, fmt.Sprintf("expected seq %d, got %d", v.report.LastSeq+1, head.Seq))
+	}
+	if head.PrevHash != v.prev && !pruned {
+		v.problem(file, number, head.Seq, "prev_hash does not match the preceding event")
+	}
+	hash := Sum(v.Key, line)
+	for _, anchor := range v.Anchors {
+		if anchor.Seq != head.Seq {
+			continue
+		}
+		if v.found == nil {
+			v.found = make(map[uint64]bool)
+		}
+		v.found[anchor.Seq] = true
+		if anchor.Hash != hash {
+			v.problem(file, number, head.Seq, "hash does not match anchor")
+		}
+	}
+	v.report.Events++
+	v.report.LastSeq = head.Seq
+	v.prev = hash
+}
+
+func (v *Verifier) Report() Report {
+	report := v.report
+	report.Head = v.prev
+	for _, anchor := range v.Anchors {
+		if !v.found[anchor.Seq] {
+			report.Problems = append(report.Problems, Problem{Seq: anchor.Seq, Message: fmt.Sprintf("anchor seq %d not found, log truncated", anchor.Seq)})
+		}
+	}
+	return report
+}
+
+func (v *Verifier) problem(file string, line int, seq uint64, message string) {
+	v.report.Problems = append(v.report.Problems, Problem{File: file, Line: line, Seq: seq, Message: message})
+}
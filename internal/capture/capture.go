@@ -0,0 +1,167 @@
+package capture
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Record struct {
+	RequestID string    `json:"request_id"`
+	Time      time.Time `json:"time"`
+	Stage     string    `json:"stage"`
+	Path      string    `json:"path"`
+	Stream    bool      `json:"stream,omitempty"`
+	Body      []byte    `json:"body"`
+}
+
+type Writer struct {
+	mu       sync.Mutex
+	path     string
+	file     *os.File
+	size     int64
+	maxBytes int64
+	keep     int
+}
+
+type WriterOption func(*Writer)
+
+// WithRotation renames the bundle to path.1 (shifting older files up to
+// path.<keep>) before a write would take it past maxBytes. With keep 0 the
+// full bundle is discarded instead.
+func WithRotation(maxBytes int64, keep int) WriterOption {
+	return func(w *Writer) {
+		w.maxBytes, w.keep = maxBytes, keep
+	}
+}
+
+func Open(path string, opts ...WriterOption) (*Writer, error) {
+	w := &Writer{path: path}
+	for _, opt := range opts {
+		opt(w)
+	}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *Writer) open() error {
+	file, err := os.OpenFile(w.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	w.file, w.size = file, info.Size()
+	return nil
+}
+
+func (w *Writer) Write(rec Record) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.maxBytes > 0 && w.size > 0 && w.size+int64(len(data)) > w.maxBytes {
+		if err := w.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := w.file.Write(data)
+	w.size += int64(n)
+	return err
+}
+
+func (w *Writer) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+	if w.keep == 0 {
+		if err := os.Remove(w.path); err != nil {
+			return err
+		}
+		return w.open()
+	}
+	for i := w.keep - 1; i >= 1; i-- {
+		from := fmt.Sprintf("%s.%d", w.path, i)
+		if _, err := os.Stat(from); err == nil {
+			if err := os.Rename(from, fmt.Sprintf("%s.%d", w.path, i+1)); err != nil {
+				return err
+			}
+		}
+	}
+	if err := os.Rename(w.path, w.path+".1"); err != nil {
+		return err
+	}
+	return w.open()
+}
+
+// Files lists the rotated bundles next to path, oldest first, followed by
+// path itself when it exists.
+func Files(path string) ([]string, error) {
+	matches, err := filepath.Glob(path + ".*")
+	if err != nil {
+		return nil, err
+	}
+	type rotated struct {
+		name string
+		n    int
+	}
+	var found []rotated
+	for _, name := range matches {
+		n, err := strconv.Atoi(strings.TrimPrefix(name, path+"."))
+		if err == nil && n > 0 {
+			found = append(found, rotated{name, n})
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].n > found[j].n })
+	files := make([]string, 0, len(found)+1)
+	for _, f := range found {
+		files = append(files, f.name)
+	}
+	if _, err := os.Stat(path); err == nil {
+		files = append(files, path)
+	}
+	return files, nil
+}
+
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.file.Close()
+}
+
+func Read(r io.Reader, fn func(Record) error) error {
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 && line[len(line)-1] == '\n' {
+			var rec Record
+			if json.Unmarshal(line, &rec) == nil && rec.RequestID != "" {
+				if err := fn(rec); err != nil {
+					return err
+				}
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package capture
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriterRotatesBySize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "replay.jsonl")
+	w, err := Open(path, WithRotation(200, 2))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	for _, id := range []string{"a", "b", "c", "d"} {
+		if err := w.Write(Record{RequestID: id, Stage: "request", Body: []byte(strings.Repeat("x", 60))}); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	_ = w.Close()
+
+	files, err := Files(path)
+	if err != nil {
+		t.Fatalf("files: %v", err)
+	}
+	if len(files) != 3 || files[0] != path+".2" || files[2] != path {
+		t.Fatalf("expected two rotated bundles and the live one, got %v", files)
+	}
+	var ids []string
+	for _, name := range files {
+		info, _ := os.Stat(name)
+		if info.Size() > 200 {
+			t.Fatalf("%s grew past the limit: %d bytes", name, info.Size())
+		}
+		data, _ := os.ReadFile(name)
+		_ = Read(bytes.NewReader(data), func(rec Record) error {
+			ids = append(ids, rec.RequestID)
+			return nil
+		})
+	}
+	if strings.Join(ids, "") != "bcd" {
+		t.Fatalf("expected the oldest record to be dropped, got %v", ids)
+	}
+}
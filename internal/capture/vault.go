@@ -0,0 +1,251 @@
+package capture
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	PublicKeyPrefix = "pifpub1"
+	SecretKeyPrefix = "PIF-SECRET-KEY-1"
+
+	sealedExt  = ".cap"
+	sealedInfo = "pif-capture-v1"
+)
+
+var (
+	ErrInvalidID = errors.New("invalid capture id")
+	ErrDecrypt   = errors.New("capture cannot be decrypted with this key")
+
+	validID = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+	keyText = base64.RawURLEncoding
+)
+
+type Exchange struct {
+	Status int         `json:"status,omitempty"`
+	Header http.Header `json:"header,omitempty"`
+	Body   []byte      `json:"body"`
+}
+
+type Forensic struct {
+	ID       string    `json:"id"`
+	Time     time.Time `json:"time"`
+	Stage    string    `json:"stage"`
+	Decision string    `json:"decision"`
+	RuleName string    `json:"rule_name,omitempty"`
+	Method   string    `json:"method"`
+	Path     string    `json:"path"`
+	Request  Exchange  `json:"request"`
+	Response *Exchange `json:"response,omitempty"`
+}
+
+type sealed struct {
+	Version    int    `json:"version"`
+	ID         string `json:"id"`
+	Ephemeral  []byte `json:"ephemeral"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// Vault only holds the recipient public key, so a compromised proxy host
+// cannot read captures it has already written.
+type Vault struct {
+	dir       string
+	recipient *ecdh.PublicKey
+}
+
+func GenerateKey() (secret, public string, err error) {
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	return SecretKeyPrefix + keyText.EncodeToString(key.Bytes()), PublicKeyPrefix + keyText.EncodeToString(key.PublicKey().Bytes()), nil
+}
+
+func ParsePublicKey(text string) (*ecdh.PublicKey, error) {
+	raw, ok := strings.CutPrefix(strings.TrimSpace(text), PublicKeyPrefix)
+	if !ok {
+		return nil, fmt.Errorf("capture public key must start with %s", PublicKeyPrefix)
+	}
+	data, err := keyText.DecodeString(raw)
+	if err != nil {
+		return nil, errors.New("capture public key is not valid base64")
+	}
+	return ecdh.X25519().NewPublicKey(data)
+}
+
+// ParseSecretKey accepts the key on its own or a keygen file with
+// comment lines.
+func ParseSecretKey(text string) (*ecdh.PrivateKey, error) {
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		raw, ok := strings.CutPrefix(line, SecretKeyPrefix)
+		if !ok {
+			return nil, fmt.Errorf("capture secret key must start with %s", SecretKeyPrefix)
+		}
+		data, err := keyText.DecodeString(raw)
+		if err != nil {
+			return nil, errors.New("capture secret key is not valid base64")
+		}
+		return ecdh.X25519().NewPrivateKey(data)
+	}
+	return nil, errors.New("no capture secret key found")
+}
+
+func NewVault(dir, publicKey string) (*Vault, error) {
+	if dir == "" {
+		return nil, errors.New("capture dir is required")
+	}
+	recipient, err := ParsePublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &Vault{dir: dir, recipient: recipient}, nil
+}
+
+func (v *Vault) Save(f Forensic) error {
+	if !validID.MatchString(f.ID) {
+		return ErrInvalidID
+	}
+	data, err := Seal(f, v.recipient)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(v.dir, ".tmp-"+f.ID+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), sealedPath(v.dir, f.ID))
+}
+
+func Load(dir, id string, key *ecdh.PrivateKey) (Forensic, error) {
+	if !validID.MatchString(id) {
+		return Forensic{}, ErrInvalidID
+	}
+	data, err := os.ReadFile(sealedPath(dir, id))
+	if err != nil {
+		return Forensic{}, err
+	}
+	f, err := Unseal(data, key)
+	if err != nil {
+		return Forensic{}, err
+	}
+	if f.ID != id {
+		return Forensic{}, fmt.Errorf("capture file %s holds id %s", id, f.ID)
+	}
+	return f, nil
+}
+
+func Seal(f Forensic, recipient *ecdh.PublicKey) ([]byte, error) {
+	plain, err := json.Marshal(f)
+	if err != nil {
+		return nil, err
+	}
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := ephemeral.ECDH(recipient)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(shared, ephemeral.PublicKey().Bytes(), recipient.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return json.Marshal(sealed{
+		Version:    1,
+		ID:         f.ID,
+		Ephemeral:  ephemeral.PublicKey().Bytes(),
+		Nonce:      nonce,
+		Ciphertext: aead.Seal(nil, nonce, plain, []byte(f.ID)),
+	})
+}
+
+func Unseal(data []byte, key *ecdh.PrivateKey) (Forensic, error) {
+	var s sealed
+	if err := json.Unmarshal(data, &s); err != nil {
+		return Forensic{}, err
+	}
+	if s.Version != 1 {
+		return Forensic{}, fmt.Errorf("unsupported capture version %d", s.Version)
+	}
+	ephemeral, err := ecdh.X25519().NewPublicKey(s.Ephemeral)
+	if err != nil {
+		return Forensic{}, err
+	}
+	shared, err := key.ECDH(ephemeral)
+	if err != nil {
+		return Forensic{}, ErrDecrypt
+	}
+	aead, err := newAEAD(shared, s.Ephemeral, key.PublicKey().Bytes())
+	if err != nil {
+		return Forensic{}, err
+	}
+	if len(s.Nonce) != aead.NonceSize() {
+		return Forensic{}, ErrDecrypt
+	}
+	plain, err := aead.Open(nil, s.Nonce, s.Ciphertext, []byte(s.ID))
+	if err != nil {
+		return Forensic{}, ErrDecrypt
+	}
+	var f Forensic
+	if err := json.Unmarshal(plain, &f); err != nil {
+		return Forensic{}, err
+	}
+	return f, nil
+}
+
+// newAEAD derives the AES-256-GCM key with HKDF-SHA256 over the shared
+// secret, salted with both public keys.
+func newAEAD(shared, ephemeral, recipient []byte) (cipher.AEAD, error) {
+	extract := hmac.New(sha256.New, bytes.Join([][]byte{ephemeral, recipient}, nil))
+	extract.Write(shared)
+	expand := hmac.New(sha256.New, extract.Sum(nil))
+	expand.Write([]byte(sealedInfo))
+	expand.Write([]byte{1})
+	block, err := aes.NewCipher(expand.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func sealedPath(dir, id string) string {
+	return filepath.Join(dir, id+sealedExt)
+}
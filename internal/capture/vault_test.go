@@ -0,0 +1,82 @@
+package capture
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestVaultRoundTrip(t *testing.T) {
+	secret, public, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("keygen: %v", err)
+	}
+	dir := t.TempDir()
+	vault, err := NewVault(dir, public)
+	if err != nil {
+		t.Fatalf("vault: %v", err)
+	}
+	f := Forensic{
+		ID:       "abc123",
+		Time:     time.Now().UTC(),
+		Stage:    "request",
+		Decision: "deny",
+		Method:   "POST",
+		Path:     "/v1/chat",
+		Request:  Exchange{Body: []byte(`{"prompt":"full body"}`)},
+	}
+	if err := vault.Save(f); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	key, err := ParseSecretKey("# public key: " + public + "\n" + secret + "\n")
+	if err != nil {
+		t.Fatalf("secret key: %v", err)
+	}
+	got, err := Load(dir, "abc123", key)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if !bytes.Equal(got.Request.Body, f.Request.Body) || got.Decision != "deny" || got.Path != "/v1/chat" {
+		t.Fatalf("unexpected capture: %+v", got)
+	}
+
+	other, _, _ := GenerateKey()
+	wrong, _ := ParseSecretKey(other)
+	if _, err := Load(dir, "abc123", wrong); !errors.Is(err, ErrDecrypt) {
+		t.Fatalf("expected ErrDecrypt for another key, got %v", err)
+	}
+	if _, err := Load(dir, "../abc123", key); err != ErrInvalidID {
+		t.Fatalf("expected ErrInvalidID, got %v", err)
+	}
+}
+
+func TestVaultRejectsSwappedCapture(t *testing.T) {
+	secret, public, _ := GenerateKey()
+	dir := t.TempDir()
+	vault, _ := NewVault(dir, public)
+	if err := vault.Save(Forensic{ID: "one", Request: Exchange{Body: []byte("a")}}); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, "one.cap"))
+	if err := os.WriteFile(filepath.Join(dir, "two.cap"), data, 0o600); err != nil {
+		t.Fatalf("copy: %v", err)
+	}
+	key, _ := ParseSecretKey(secret)
+	if _, err := Load(dir, "two", key); err == nil {
+		t.Fatal("expected a capture renamed to another id to be rejected")
+	}
+	tampered := bytes.Replace(data, []byte(`"id":"one"`), []byte(`"id":"two"`), 1)
+	if _, err := Unseal(tampered, key); !errors.Is(err, ErrDecrypt) {
+		t.Fatalf("expected ErrDecrypt for a rewritten id, got %v", err)
+	}
+}
+
+func TestParsePublicKeyRejectsSecretKey(t *testing.T) {
+	secret, _, _ := GenerateKey()
+	if _, err := ParsePublicKey(secret); err == nil {
+		t.Fatal("expected a secret key to be rejected as public key")
+	}
+}
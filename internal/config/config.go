@@ -1,47 +1,155 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"net/url"
 	"os"
+	"regexp"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
-	ListenAddr    string        `yaml:"listen_addr"`
-	Upstream      string        `yaml:"upstream"`
-	AuditLogPath  string        `yaml:"audit_log_path"`
-	MaxBodyBytes  int64         `yaml:"max_body_bytes"`
-	Approval      Approval      `yaml:"approval"`
-	Rules         []Rule        `yaml:"rules"`
-	TimeFormat    string        `yaml:"time_format"`
-	DecisionOrder []string      `yaml:"decision_order"`
-	Headers       HeaderOptions `yaml:"headers"`
+	ListenAddr       string        `yaml:"listen_addr"`
+	Upstream         string        `yaml:"upstream"`
+	AuditLogPath     string        `yaml:"audit_log_path"`
+	AuditRotation    AuditRotation `yaml:"audit_rotation"`
+	Redaction        Redaction     `yaml:"redaction"`
+	Replay           Replay        `yaml:"replay"`
+	Capture          Capture       `yaml:"capture"`
+	MaxBodyBytes     int64         `yaml:"max_body_bytes"`
+	MaxResponseBytes int64         `yaml:"max_response_bytes"`
+	Approval         Approval      `yaml:"approval"`
+	Rules            []Rule        `yaml:"rules"`
+	TimeFormat       string        `yaml:"time_format"`
+	DecisionOrder    []string      `yaml:"decision_order"`
+	Headers          HeaderOptions `yaml:"headers"`
+	Stream           StreamOptions `yaml:"stream"`
+	Routes           []Route       `yaml:"routes"`
+	Scoring          Scoring       `yaml:"scoring"`
+	DryRun           bool          `yaml:"dry_run"`
+	Version          string        `yaml:"-"`
 }
 
 type Approval struct {
-	Enabled bool          `yaml:"enabled"`
-	Token   string        `yaml:"token"`
-	TTL     time.Duration `yaml:"ttl"`
+	Enabled        bool          `yaml:"enabled"`
+	Token          string        `yaml:"token"`
+	TTL            time.Duration `yaml:"ttl"`
+	Store          string        `yaml:"store"`
+	StorePath      string        `yaml:"store_path"`
+	HoldConnection bool          `yaml:"hold_connection"`
+	Approvers      []Approver    `yaml:"approvers"`
+	PublicURL      string        `yaml:"public_url"`
+	UIPath         string        `yaml:"ui_path"`
+	Webhooks       []Webhook     `yaml:"webhooks"`
+	SessionHeader  string        `yaml:"session_header"`
+}
+
+type AuditRotation struct {
+	MaxBytes    int64         `yaml:"max_bytes"`
+	Interval    time.Duration `yaml:"interval"`
+	Compress    bool          `yaml:"compress"`
+	MaxSegments int           `yaml:"max_segments"`
+	MaxAge      time.Duration `yaml:"max_age"`
+}
+
+type Replay struct {
+	CapturePath string `yaml:"capture_path"`
+	MaxBytes    int64  `yaml:"max_bytes"`
+	MaxFiles    int    `yaml:"max_files"`
+}
+
+type Capture struct {
+	Dir        string   `yaml:"dir"`
+	PublicKey  string   `yaml:"public_key"`
+	Decisions  []string `yaml:"decisions"`
+	SampleRate float64  `yaml:"sample_rate"`
+}
+
+type Redaction struct {
+	Disabled  bool             `yaml:"disabled"`
+	Detectors []string         `yaml:"detectors"`
+	Custom    []CustomDetector `yaml:"custom"`
+}
+
+type CustomDetector struct {
+	Name    string `yaml:"name"`
+	Pattern string `yaml:"pattern"`
+}
+
+type Webhook struct {
+	URL     string   `yaml:"url"`
+	Secret  string   `yaml:"secret"`
+	Events  []string `yaml:"events"`
+	Retries int      `yaml:"retries"`
+}
+
+type Approver struct {
+	Name  string   `yaml:"name"`
+	Token string   `yaml:"token"`
+	Roles []string `yaml:"roles"`
+}
+
+type RuleApproval struct {
+	Quorum int      `yaml:"quorum"`
+	Roles  []string `yaml:"roles"`
 }
 
 type HeaderOptions struct {
 	AddRequestIDHeader bool `yaml:"add_request_id_header"`
 }
 
+type StreamOptions struct {
+	WindowBytes int `yaml:"window_bytes"`
+}
+
+type Scoring struct {
+	Enabled    bool            `yaml:"enabled"`
+	Thresholds ScoreThresholds `yaml:"thresholds"`
+}
+
+type ScoreThresholds struct {
+	Approve float64 `yaml:"approve"`
+	Deny    float64 `yaml:"deny"`
+}
+
+type Route struct {
+	PathPrefix string `yaml:"path_prefix"`
+	Format     string `yaml:"format"`
+}
+
 type Rule struct {
-	Name   string `yaml:"name"`
-	Stage  string `yaml:"stage"`
-	Action string `yaml:"action"`
-	Match  Match  `yaml:"match"`
+	Name     string       `yaml:"name"`
+	Stage    string       `yaml:"stage"`
+	Action   string       `yaml:"action"`
+	Score    float64      `yaml:"score"`
+	Mode     string       `yaml:"mode"`
+	Match    Match        `yaml:"match"`
+	Approval RuleApproval `yaml:"approval"`
 }
 
 type Match struct {
-	Pattern   string   `yaml:"pattern"`
-	ToolNames []string `yaml:"tool_names"`
-	Field     string   `yaml:"field"`
+	Pattern   string     `yaml:"pattern"`
+	ToolNames []string   `yaml:"tool_names"`
+	Field     string     `yaml:"field"`
+	Roles     []string   `yaml:"roles"`
+	ToolArgs  []ArgMatch `yaml:"tool_args"`
+	All       []Match    `yaml:"all"`
+	Any       []Match    `yaml:"any"`
+	Not       *Match     `yaml:"not"`
+}
+
+type ArgMatch struct {
+	Tool    string `yaml:"tool"`
+	Arg     string `yaml:"arg"`
+	Pattern string `yaml:"pattern"`
+	Glob    string `yaml:"glob"`
+	Source  string `yaml:"source"`
 }
 
 func Load(path string) (Config, error) {
@@ -57,9 +165,15 @@ func Load(path string) (Config, error) {
 	if err := validate(cfg); err != nil {
 		return cfg, err
 	}
+	cfg.Version = Version(data)
 	return cfg, nil
 }
 
+func Version(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
 func applyDefaults(cfg *Config) {
 	if cfg.ListenAddr == "" {
 		cfg.ListenAddr = ":8080"
@@ -67,9 +181,15 @@ func applyDefaults(cfg *Config) {
 	if cfg.MaxBodyBytes == 0 {
 		cfg.MaxBodyBytes = 1024 * 1024
 	}
+	if cfg.MaxResponseBytes == 0 {
+		cfg.MaxResponseBytes = 4 * 1024 * 1024
+	}
 	if cfg.AuditLogPath == "" {
 		cfg.AuditLogPath = "audit.jsonl"
 	}
+	if cfg.Stream.WindowBytes == 0 {
+		cfg.Stream.WindowBytes = 4096
+	}
 	if cfg.TimeFormat == "" {
 		cfg.TimeFormat = time.RFC3339Nano
 	}
@@ -79,22 +199,270 @@ func applyDefaults(cfg *Config) {
 	if len(cfg.DecisionOrder) == 0 {
 		cfg.DecisionOrder = []string{"deny", "approve", "allow"}
 	}
+	if cfg.Replay.MaxBytes == 0 {
+		cfg.Replay.MaxBytes = 100 * 1024 * 1024
+	}
+	if cfg.Replay.MaxFiles == 0 {
+		cfg.Replay.MaxFiles = 1
+	}
+	if cfg.Capture.Dir != "" && len(cfg.Capture.Decisions) == 0 {
+		cfg.Capture.Decisions = []string{"deny", "approve"}
+	}
+	if cfg.Approval.SessionHeader == "" {
+		cfg.Approval.SessionHeader = "X-Session-ID"
+	}
+	if cfg.Approval.UIPath == "" {
+		cfg.Approval.UIPath = "/_pif/"
+	}
+	if !strings.HasSuffix(cfg.Approval.UIPath, "/") {
+		cfg.Approval.UIPath += "/"
+	}
+	for i := range cfg.Approval.Webhooks {
+		if cfg.Approval.Webhooks[i].Retries == 0 {
+			cfg.Approval.Webhooks[i].Retries = 3
+		}
+	}
 }
 
 func validate(cfg Config) error {
 	if cfg.Upstream == "" {
 		return errors.New("upstream is required")
 	}
+	rotation := cfg.AuditRotation
+	if rotation.MaxBytes < 0 || rotation.Interval < 0 || rotation.MaxSegments < 0 || rotation.MaxAge < 0 {
+		return errors.New("audit_rotation values must not be negative")
+	}
+	if cfg.Replay.MaxBytes < 0 || cfg.Replay.MaxFiles < 0 {
+		return errors.New("replay values must not be negative")
+	}
+	if err := validateCapture(cfg.Capture); err != nil {
+		return err
+	}
+	switch strings.ToLower(cfg.Approval.Store) {
+	case "", "memory":
+	case "file":
+		if cfg.Approval.StorePath == "" {
+			return errors.New("approval store_path is required for the file store")
+		}
+	default:
+		return fmt.Errorf("unknown approval store %q", cfg.Approval.Store)
+	}
+	names := map[string]bool{}
+	tokens := map[string]bool{}
+	for i, approver := range cfg.Approval.Approvers {
+		if approver.Name == "" || approver.Token == "" {
+			return fmt.Errorf("approver %d requires name and token", i)
+		}
+		if approver.Name == "shared" {
+			return errors.New("approver name shared is reserved for approval.token")
+		}
+		if names[approver.Name] {
+			return fmt.Errorf("approver %s is defined twice", approver.Name)
+		}
+		if tokens[approver.Token] || approver.Token == cfg.Approval.Token {
+			return fmt.Errorf("approver %s reuses another token", approver.Name)
+		}
+		names[approver.Name] = true
+		tokens[approver.Token] = true
+	}
+	if !strings.HasPrefix(cfg.Approval.UIPath, "/") || cfg.Approval.UIPath == "/" || strings.HasPrefix(cfg.Approval.UIPath, "/approvals/") {
+		return fmt.Errorf("approval ui_path %q must be a dedicated absolute path", cfg.Approval.UIPath)
+	}
+	for i, hook := range cfg.Approval.Webhooks {
+		if err := validateWebhook(hook); err != nil {
+			return fmt.Errorf("webhook %d: %w", i, err)
+		}
+	}
+	if cfg.Scoring.Enabled {
+		thresholds := cfg.Scoring.Thresholds
+		if thresholds.Approve <= 0 && thresholds.Deny <= 0 {
+			return errors.New("scoring requires an approve or deny threshold")
+		}
+		if thresholds.Approve > 0 && thresholds.Deny > 0 && thresholds.Approve >= thresholds.Deny {
+			return errors.New("scoring approve threshold must be below deny threshold")
+		}
+	}
+	for i, route := range cfg.Routes {
+		if route.PathPrefix == "" {
+			return fmt.Errorf("route %d missing path_prefix", i)
+		}
+	}
 	for i, rule := range cfg.Rules {
 		if rule.Name == "" {
 			return fmt.Errorf("rule %d missing name", i)
 		}
-		if rule.Action == "" {
+		if rule.Action == "" && !cfg.Scoring.Enabled {
 			return fmt.Errorf("rule %s missing action", rule.Name)
 		}
+		if rule.Action == "" && rule.Score == 0 {
+			return fmt.Errorf("rule %s needs an action or a score", rule.Name)
+		}
+		switch strings.ToLower(rule.Mode) {
+		case "", "enforce", "monitor":
+		default:
+			return fmt.Errorf("rule %s has unknown mode %q", rule.Name, rule.Mode)
+		}
+		if rule.Score < 0 {
+			return fmt.Errorf("rule %s has negative score", rule.Name)
+		}
 		if rule.Stage == "" {
 			return fmt.Errorf("rule %s missing stage", rule.Name)
 		}
+		switch strings.ToLower(rule.Stage) {
+		case "request", "response":
+		default:
+			return fmt.Errorf("rule %s has unknown stage %q", rule.Name, rule.Stage)
+		}
+		if err := validateMatch(rule.Match, "match"); err != nil {
+			return fmt.Errorf("rule %s: %w", rule.Name, err)
+		}
+		if err := validateRuleApproval(rule.Approval, cfg.Approval); err != nil {
+			return fmt.Errorf("rule %s: %w", rule.Name, err)
+		}
+	}
+	return nil
+}
+
+func validateCapture(c Capture) error {
+	if c.Dir == "" {
+		if c.PublicKey != "" {
+			return errors.New("capture dir is required when public_key is set")
+		}
+		return nil
+	}
+	for _, decision := range c.Decisions {
+		switch decision {
+		case "deny", "approve", "allow":
+		default:
+			return fmt.Errorf("capture has unknown decision %q", decision)
+		}
+	}
+	if c.SampleRate < 0 || c.SampleRate > 1 {
+		return errors.New("capture sample_rate must be between 0 and 1")
+	}
+	return nil
+}
+
+func validateWebhook(hook Webhook) error {
+	parsed, err := url.Parse(hook.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("invalid url %q", hook.URL)
+	}
+	if hook.Secret == "" {
+		return errors.New("secret is required")
+	}
+	if hook.Retries < 0 {
+		return errors.New("retries must not be negative")
+	}
+	for _, event := range hook.Events {
+		switch strings.TrimPrefix(strings.ToLower(event), "approval.") {
+		case "created", "approved", "rejected", "expired":
+		default:
+			return fmt.Errorf("unknown event %q", event)
+		}
+	}
+	return nil
+}
+
+func validateRuleApproval(ra RuleApproval, approval Approval) error {
+	if ra.Quorum < 0 {
+		return errors.New("approval quorum must not be negative")
+	}
+	if ra.Quorum <= 1 && len(ra.Roles) == 0 {
+		return nil
+	}
+	if ra.Quorum > 1 && approval.Token != "" {
+		return errors.New("approval quorum above 1 cannot be used with the shared approval.token; give every approver their own token")
+	}
+	eligible := 0
+	for _, approver := range approval.Approvers {
+		if approver.HasAnyRole(ra.Roles) {
+			eligible++
+		}
+	}
+	if eligible == 0 {
+		return errors.New("approval requires named approvers with a matching role")
+	}
+	if ra.Quorum > eligible {
+		return fmt.Errorf("approval quorum %d exceeds %d eligible approvers", ra.Quorum, eligible)
+	}
+	return nil
+}
+
+func (a Approver) HasAnyRole(roles []string) bool {
+	if len(roles) == 0 {
+		return true
+	}
+	for _, role := range roles {
+		for _, candidate := range a.Roles {
+			if strings.EqualFold(role, candidate) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func validateMatch(m Match, path string) error {
+	if m.Pattern != "" {
+		if _, err := regexp.Compile(m.Pattern); err != nil {
+			return fmt.Errorf("%s has invalid pattern: %w", path, err)
+		}
+	}
+	if m.Field != "" && len(m.Roles) > 0 {
+		return fmt.Errorf("%s cannot combine field and roles", path)
+	}
+	for _, arg := range m.ToolArgs {
+		if err := validateArgMatch(arg); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	if m.All != nil && len(m.All) == 0 {
+		return fmt.Errorf("%s.all is empty", path)
+	}
+	if m.Any != nil && len(m.Any) == 0 {
+		return fmt.Errorf("%s.any is empty", path)
+	}
+	for i, child := range m.All {
+		if err := validateChild(child, fmt.Sprintf("%s.all[%d]", path, i)); err != nil {
+			return err
+		}
+	}
+	for i, child := range m.Any {
+		if err := validateChild(child, fmt.Sprintf("%s.any[%d]", path, i)); err != nil {
+			return err
+		}
+	}
+	if m.Not != nil {
+		if err := validateChild(*m.Not, path+".not"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateChild(m Match, path string) error {
+	if m.IsEmpty() {
+		return fmt.Errorf("%s has no conditions", path)
+	}
+	return validateMatch(m, path)
+}
+
+func (m Match) IsEmpty() bool {
+	return m.Pattern == "" && m.Field == "" && len(m.ToolNames) == 0 && len(m.Roles) == 0 &&
+		len(m.ToolArgs) == 0 && m.All == nil && m.Any == nil && m.Not == nil
+}
+
+func validateArgMatch(arg ArgMatch) error {
+	if arg.Pattern != "" {
+		if _, err := regexp.Compile(arg.Pattern); err != nil {
+			return fmt.Errorf("tool_args has invalid pattern: %w", err)
+		}
+	}
+	switch strings.ToLower(arg.Source) {
+	case "", "call", "result", "any":
+	default:
+		return fmt.Errorf("tool_args has unknown source %q", arg.Source)
 	}
 	return nil
 }
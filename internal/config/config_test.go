@@ -0,0 +1,102 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadRejectsInvalidMatchTrees(t *testing.T) {
+	cases := map[string]string{
+		"empty all": `
+      all: []`,
+		"empty child": `
+      any:
+        - {}`,
+		"bad nested pattern": `
+      not:
+        pattern: "("`,
+	}
+	for name, match := range cases {
+		path := writeConfig(t, `
+upstream: "http://localhost:9090"
+rules:
+  - name: "r"
+    stage: "request"
+    action: "deny"
+    match:`+match+"\n")
+		if _, err := Load(path); err == nil {
+			t.Fatalf("%s: expected validation error", name)
+		}
+	}
+}
+
+func TestLoadAcceptsNestedMatch(t *testing.T) {
+	path := writeConfig(t, `
+upstream: "http://localhost:9090"
+rules:
+  - name: "deny_exec_injection"
+    stage: "request"
+    action: "deny"
+    match:
+      all:
+        - tool_names: ["exec_command"]
+        - pattern: "(?i)curl"
+        - not:
+            roles: ["system"]
+`)
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := len(cfg.Rules[0].Match.All); got != 3 {
+		t.Fatalf("expected 3 conditions, got %d", got)
+	}
+}
+
+func TestLoadValidatesApprovalQuorum(t *testing.T) {
+	base := `
+upstream: "http://localhost:9090"
+approval:
+  enabled: true
+  approvers:
+    - name: "alice"
+      token: "a"
+      roles: ["security"]
+    - name: "bob"
+      token: "b"
+rules:
+  - name: "exec"
+    stage: "request"
+    action: "approve"
+    match:
+      tool_names: ["exec_command"]
+    approval:
+`
+	if _, err := Load(writeConfig(t, base+"      quorum: 2\n")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := Load(writeConfig(t, base+"      quorum: 2\n      roles: [\"security\"]\n")); err == nil {
+		t.Fatalf("expected quorum above eligible approvers to fail")
+	}
+	if _, err := Load(writeConfig(t, strings.Replace(base, `token: "b"`, `token: "a"`, 1)+"      quorum: 1\n")); err == nil {
+		t.Fatalf("expected duplicate approver token to fail")
+	}
+	shared := strings.Replace(base, "  enabled: true\n", "  enabled: true\n  token: \"team\"\n", 1)
+	if _, err := Load(writeConfig(t, shared+"      quorum: 2\n")); err == nil {
+		t.Fatalf("expected shared token with a quorum above 1 to fail")
+	}
+	if _, err := Load(writeConfig(t, shared+"      quorum: 1\n")); err != nil {
+		t.Fatalf("unexpected error for shared token with single approvals: %v", err)
+	}
+}
+
+func writeConfig(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(strings.TrimLeft(body, "\n")), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	return path
+}
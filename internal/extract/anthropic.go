@@ -0,0 +1,94 @@
+package extract
+
+import "fmt"
+
+func anthropicRequest(root map[string]interface{}) ([]Segment, []string) {
+	var segments []Segment
+	switch val := root["system"].(type) {
+	case string:
+		segments = append(segments, Segment{Role: "system", PartType: "text", Path: "system", Text: val})
+	case []interface{}:
+		segments = append(segments, readBlocks("system", "system", 0, val)...)
+	}
+	if messages, ok := root["messages"].([]interface{}); ok {
+		for i, item := range messages {
+			msg, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			role, _ := msg["role"].(string)
+			if role == "" {
+				role = "user"
+			}
+			path := fmt.Sprintf("messages[%d].content", i)
+			switch val := msg["content"].(type) {
+			case string:
+				segments = append(segments, Segment{Role: role, Index: i, PartType: "text", Path: path, Text: val})
+			case []interface{}:
+				segments = append(segments, readBlocks(path, role, i, val)...)
+			}
+		}
+	}
+	return segments, dedupe(readTools(root["tools"]))
+}
+
+func anthropicResponse(root map[string]interface{}) ([]Segment, []string) {
+	blocks, _ := root["content"].([]interface{})
+	role, _ := root["role"].(string)
+	if role == "" {
+		role = "assistant"
+	}
+	segments := readBlocks("content", role, 0, blocks)
+	return segments, dedupe(blockToolNames(blocks))
+}
+
+func readBlocks(path, role string, index int, blocks []interface{}) []Segment {
+	var out []Segment
+	for j, item := range blocks {
+		block, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		blockPath := fmt.Sprintf("%s[%d]", path, j)
+		blockType, _ := block["type"].(string)
+		switch blockType {
+		case "tool_result":
+			switch val := block["content"].(type) {
+			case string:
+				out = append(out, Segment{Role: "tool", Index: index, PartType: "tool_result", Path: blockPath + ".content", Text: val})
+			case []interface{}:
+				for k, inner := range val {
+					obj, ok := inner.(map[string]interface{})
+					if !ok {
+						continue
+					}
+					if text, ok := obj["text"].(string); ok {
+						out = append(out, Segment{Role: "tool", Index: index, PartType: "tool_result", Path: fmt.Sprintf("%s.content[%d].text", blockPath, k), Text: text})
+					}
+				}
+			}
+		default:
+			if text, ok := block["text"].(string); ok {
+				if blockType == "" {
+					blockType = "text"
+				}
+				out = append(out, Segment{Role: role, Index: index, PartType: blockType, Path: blockPath + ".text", Text: text})
+			}
+		}
+	}
+	return out
+}
+
+func blockToolNames(blocks []interface{}) []string {
+	var out []string
+	for _, item := range blocks {
+		block, ok := item.(map[string]interface{})
+		if !ok || block["type"] != "tool_use" {
+			continue
+		}
+		if name, ok := block["name"].(string); ok {
+			out = append(out, name)
+		}
+	}
+	return out
+}
@@ -3,39 +3,152 @@ package extract
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
 )
 
 type Result struct {
 	Text      string
 	ToolNames []string
+	ToolCalls []ToolCall
+	Segments  []Segment
+	root      interface{}
+}
+
+type Segment struct {
+	Role     string
+	Index    int
+	PartType string
+	Path     string
+	Text     string
+}
+
+func (r Result) Select(sel Selector) []string {
+	if r.root == nil {
+		return nil
+	}
+	return sel.Values(r.root)
+}
+
+func (r Result) TextForRoles(roles []string) []string {
+	var out []string
+	for _, seg := range r.Segments {
+		for _, role := range roles {
+			if strings.EqualFold(seg.Role, role) {
+				out = append(out, seg.Text)
+				break
+			}
+		}
+	}
+	return out
 }
 
 func FromJSON(body []byte) (Result, error) {
+	return FromJSONFormat(body, FormatAuto)
+}
+
+func FromJSONFormat(body []byte, format Format) (Result, error) {
+	root, err := parseRoot(body)
+	if err != nil {
+		return Result{}, err
+	}
+	var segments []Segment
+	var tools []string
+	var calls []ToolCall
+	if format == FormatAuto {
+		segments, tools, calls = autoRequest(root)
+	} else {
+		segments, tools = formatRequest(root, format)
+		calls = requestToolCalls(root, format)
+	}
+	return Result{
+		Text:      joinSegments(segments),
+		ToolNames: tools,
+		ToolCalls: calls,
+		Segments:  segments,
+		root:      root,
+	}, nil
+}
+
+var requestFields = []struct {
+	format Format
+	keys   []string
+}{
+	{FormatOpenAI, []string{"input", "messages", "prompt"}},
+	{FormatAnthropic, []string{"system", "messages"}},
+	{FormatGemini, []string{"systemInstruction", "system_instruction", "contents"}},
+}
+
+// autoRequest reads the detected format first and then every field only
+// another format reads, so a client cannot hide text from the rules by
+// adding a marker key for a different format.
+func autoRequest(root map[string]interface{}) ([]Segment, []string, []ToolCall) {
+	primary := detectRequest(root)
+	segments, tools := formatRequest(root, primary)
+	calls := requestToolCalls(root, primary)
+	covered := map[string]bool{}
+	for _, shape := range requestFields {
+		if shape.format != primary {
+			continue
+		}
+		for _, key := range shape.keys {
+			covered[key] = true
+		}
+	}
+	for _, shape := range requestFields {
+		if shape.format == primary {
+			continue
+		}
+		rest := map[string]interface{}{}
+		for _, key := range shape.keys {
+			if value, ok := root[key]; ok && !covered[key] {
+				rest[key] = value
+			}
+			covered[key] = true
+		}
+		extra, _ := formatRequest(rest, shape.format)
+		segments = append(segments, extra...)
+		calls = append(calls, requestToolCalls(rest, shape.format)...)
+		_, names := formatRequest(map[string]interface{}{"tools": root["tools"], "functions": root["functions"]}, shape.format)
+		tools = append(tools, names...)
+	}
+	return segments, dedupe(tools), calls
+}
+
+func formatRequest(root map[string]interface{}, format Format) ([]Segment, []string) {
+	switch format {
+	case FormatAnthropic:
+		return anthropicRequest(root)
+	case FormatGemini:
+		return geminiRequest(root)
+	default:
+		return collectSegments(root), collectTools(root)
+	}
+}
+
+func parseRoot(body []byte) (map[string]interface{}, error) {
 	var raw interface{}
 	if err := json.Unmarshal(body, &raw); err != nil {
-		return Result{}, err
+		return nil, err
 	}
 	root, ok := raw.(map[string]interface{})
 	if !ok {
-		return Result{}, fmt.Errorf("json root not object")
+		return nil, fmt.Errorf("json root not object")
 	}
-	text := collectText(root)
-	tools := collectTools(root)
-	return Result{Text: text, ToolNames: tools}, nil
+	return root, nil
 }
 
-func collectText(root map[string]interface{}) string {
-	parts := []string{}
+func collectSegments(root map[string]interface{}) []Segment {
+	var out []Segment
 	if input, ok := root["input"]; ok {
-		parts = append(parts, readInputField(input)...)
+		out = append(out, readInputField(input)...)
 	}
 	if messages, ok := root["messages"]; ok {
-		parts = append(parts, readMessages(messages)...)
+		out = append(out, readMessages(messages)...)
 	}
 	if prompt, ok := root["prompt"]; ok {
-		parts = append(parts, readPrompt(prompt)...)
+		out = append(out, readPrompt(prompt)...)
 	}
-	return join(parts)
+	return out
 }
 
 func collectTools(root map[string]interface{}) []string {
@@ -45,58 +158,89 @@ func collectTools(root map[string]interface{}) []string {
 	return dedupe(out)
 }
 
-func readInputField(input interface{}) []string {
+func readInputField(input interface{}) []Segment {
 	switch val := input.(type) {
 	case string:
-		return []string{val}
+		return []Segment{{Role: "user", PartType: "text", Path: "input", Text: val}}
 	case []interface{}:
-		return readArrayText(val)
+		return readArrayText("input", val)
 	case map[string]interface{}:
-		return readContent(val)
+		return readMessage("input", 0, val)
 	default:
 		return nil
 	}
 }
 
-func readMessages(messages interface{}) []string {
+func readMessages(messages interface{}) []Segment {
 	arr, ok := messages.([]interface{})
 	if !ok {
 		return nil
 	}
-	return readArrayText(arr)
+	return readArrayText("messages", arr)
 }
 
-func readPrompt(prompt interface{}) []string {
+func readPrompt(prompt interface{}) []Segment {
 	switch val := prompt.(type) {
 	case string:
-		return []string{val}
+		return []Segment{{Role: "user", PartType: "text", Path: "prompt", Text: val}}
 	case []interface{}:
-		return readArrayStrings(val)
+		var out []Segment
+		for i, item := range val {
+			if str, ok := item.(string); ok {
+				out = append(out, Segment{Role: "user", Index: i, PartType: "text", Path: fmt.Sprintf("prompt[%d]", i), Text: str})
+			}
+		}
+		return out
 	default:
 		return nil
 	}
 }
 
-func readArrayText(arr []interface{}) []string {
-	var out []string
-	for _, item := range arr {
+func readArrayText(field string, arr []interface{}) []Segment {
+	var out []Segment
+	for i, item := range arr {
+		path := fmt.Sprintf("%s[%d]", field, i)
 		switch val := item.(type) {
 		case string:
-			out = append(out, val)
+			out = append(out, Segment{Role: "user", Index: i, PartType: "text", Path: path, Text: val})
 		case map[string]interface{}:
-			out = append(out, readContent(val)...)
+			out = append(out, readMessage(path, i, val)...)
 		}
 	}
 	return out
 }
 
-func readArrayStrings(arr []interface{}) []string {
-	var out []string
-	for _, item := range arr {
-		if str, ok := item.(string); ok {
-			out = append(out, str)
+func readMessage(path string, index int, obj map[string]interface{}) []Segment {
+	role, _ := obj["role"].(string)
+	if role == "" {
+		role = "user"
+	}
+	var out []Segment
+	if content, ok := obj["content"]; ok {
+		switch val := content.(type) {
+		case string:
+			out = append(out, Segment{Role: role, Index: index, PartType: "text", Path: path + ".content", Text: val})
+		case []interface{}:
+			for j, item := range val {
+				part, ok := item.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				text, ok := part["text"].(string)
+				if !ok {
+					continue
+				}
+				partType, _ := part["type"].(string)
+				if partType == "" {
+					partType = "text"
+				}
+				out = append(out, Segment{Role: role, Index: index, PartType: partType, Path: fmt.Sprintf("%s.content[%d].text", path, j), Text: text})
+			}
 		}
 	}
+	if text, ok := obj["text"].(string); ok {
+		out = append(out, Segment{Role: role, Index: index, PartType: "text", Path: path + ".text", Text: text})
+	}
 	return out
 }
 
@@ -148,6 +292,11 @@ func readTools(field interface{}) []string {
 				out = append(out, str)
 			}
 		}
+		if fn, ok := obj["function"].(map[string]interface{}); ok {
+			if str, ok := fn["name"].(string); ok {
+				out = append(out, str)
+			}
+		}
 	}
 	return out
 }
@@ -165,6 +314,14 @@ func dedupe(items []string) []string {
 	return out
 }
 
+func joinSegments(segments []Segment) string {
+	parts := make([]string, 0, len(segments))
+	for _, seg := range segments {
+		parts = append(parts, seg.Text)
+	}
+	return join(parts)
+}
+
 func join(parts []string) string {
 	if len(parts) == 0 {
 		return ""
@@ -175,3 +332,112 @@ func join(parts []string) string {
 	}
 	return out
 }
+
+func FromResponseJSON(body []byte) (Result, error) {
+	return FromResponseJSONFormat(body, FormatAuto)
+}
+
+func FromResponseJSONFormat(body []byte, format Format) (Result, error) {
+	root, err := parseRoot(body)
+	if err != nil {
+		return Result{}, err
+	}
+	if format == FormatAuto {
+		format = detectResponse(root)
+	}
+	var segments []Segment
+	var tools []string
+	switch format {
+	case FormatAnthropic:
+		segments, tools = anthropicResponse(root)
+	case FormatGemini:
+		segments, tools = geminiResponse(root)
+	default:
+		segments, tools = openaiResponse(root)
+	}
+	return Result{
+		Text:      joinSegments(segments),
+		ToolNames: tools,
+		ToolCalls: responseToolCalls(root, format),
+		Segments:  segments,
+		root:      root,
+	}, nil
+}
+
+func openaiResponse(root map[string]interface{}) ([]Segment, []string) {
+	var segments []Segment
+	var tools []string
+	if choices, ok := root["choices"].([]interface{}); ok {
+		for i, item := range choices {
+			choice, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			path := fmt.Sprintf("choices[%d]", i)
+			if text, ok := choice["text"].(string); ok {
+				segments = append(segments, Segment{Role: "assistant", Index: i, PartType: "text", Path: path + ".text", Text: text})
+			}
+			if message, ok := choice["message"].(map[string]interface{}); ok {
+				if _, ok := message["role"]; !ok {
+					message = withRole(message, "assistant")
+				}
+				segments = append(segments, readMessage(path+".message", i, message)...)
+				tools = append(tools, readToolCalls(message)...)
+			}
+		}
+	}
+	if output, ok := root["output"].([]interface{}); ok {
+		for i, item := range output {
+			obj, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			switch obj["type"] {
+			case "function_call":
+				if name, ok := obj["name"].(string); ok {
+					tools = append(tools, name)
+				}
+			default:
+				if _, ok := obj["role"]; !ok {
+					obj = withRole(obj, "assistant")
+				}
+				segments = append(segments, readMessage(fmt.Sprintf("output[%d]", i), i, obj)...)
+			}
+		}
+	} else if text, ok := root["output_text"].(string); ok {
+		segments = append(segments, Segment{Role: "assistant", PartType: "text", Path: "output_text", Text: text})
+	}
+	return segments, dedupe(tools)
+}
+
+func withRole(obj map[string]interface{}, role string) map[string]interface{} {
+	out := make(map[string]interface{}, len(obj)+1)
+	for key, value := range obj {
+		out[key] = value
+	}
+	out["role"] = role
+	return out
+}
+
+func readToolCalls(message map[string]interface{}) []string {
+	var out []string
+	if calls, ok := message["tool_calls"].([]interface{}); ok {
+		for _, item := range calls {
+			call, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if fn, ok := call["function"].(map[string]interface{}); ok {
+				if name, ok := fn["name"].(string); ok {
+					out = append(out, name)
+				}
+			}
+		}
+	}
+	if fn, ok := message["function_call"].(map[string]interface{}); ok {
+		if name, ok := fn["name"].(string); ok {
+			out = append(out, name)
+		}
+	}
+	return out
+}
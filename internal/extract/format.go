@@ -0,0 +1,85 @@
+package extract
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Format string
+
+const (
+	FormatAuto      Format = "auto"
+	FormatOpenAI    Format = "openai"
+	FormatAnthropic Format = "anthropic"
+	FormatGemini    Format = "gemini"
+)
+
+func ParseFormat(value string) (Format, error) {
+	switch Format(strings.ToLower(value)) {
+	case "", FormatAuto:
+		return FormatAuto, nil
+	case FormatOpenAI:
+		return FormatOpenAI, nil
+	case FormatAnthropic:
+		return FormatAnthropic, nil
+	case FormatGemini:
+		return FormatGemini, nil
+	default:
+		return "", fmt.Errorf("unknown format %q", value)
+	}
+}
+
+func detectRequest(root map[string]interface{}) Format {
+	for _, key := range []string{"contents", "systemInstruction", "system_instruction"} {
+		if _, ok := root[key]; ok {
+			return FormatGemini
+		}
+	}
+	if _, ok := root["anthropic_version"]; ok {
+		return FormatAnthropic
+	}
+	if _, ok := root["messages"]; ok {
+		if _, ok := root["system"]; ok {
+			return FormatAnthropic
+		}
+	}
+	if tools, ok := root["tools"].([]interface{}); ok {
+		for _, item := range tools {
+			if tool, ok := item.(map[string]interface{}); ok {
+				if _, ok := tool["input_schema"]; ok {
+					return FormatAnthropic
+				}
+			}
+		}
+	}
+	if messages, ok := root["messages"].([]interface{}); ok {
+		for _, item := range messages {
+			msg, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			blocks, _ := msg["content"].([]interface{})
+			for _, block := range blocks {
+				if obj, ok := block.(map[string]interface{}); ok {
+					switch obj["type"] {
+					case "tool_use", "tool_result":
+						return FormatAnthropic
+					}
+				}
+			}
+		}
+	}
+	return FormatOpenAI
+}
+
+func detectResponse(root map[string]interface{}) Format {
+	if _, ok := root["candidates"]; ok {
+		return FormatGemini
+	}
+	if root["type"] == "message" {
+		if _, ok := root["content"].([]interface{}); ok {
+			return FormatAnthropic
+		}
+	}
+	return FormatOpenAI
+}
@@ -0,0 +1,121 @@
+package extract
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+func geminiRequest(root map[string]interface{}) ([]Segment, []string) {
+	var segments []Segment
+	for _, key := range []string{"systemInstruction", "system_instruction"} {
+		if system, ok := root[key].(map[string]interface{}); ok {
+			parts, _ := system["parts"].([]interface{})
+			segments = append(segments, readParts(key+".parts", "system", 0, parts)...)
+		}
+	}
+	if contents, ok := root["contents"].([]interface{}); ok {
+		for i, item := range contents {
+			content, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			parts, _ := content["parts"].([]interface{})
+			segments = append(segments, readParts(fmt.Sprintf("contents[%d].parts", i), geminiRole(content["role"]), i, parts)...)
+		}
+	}
+	var tools []string
+	if arr, ok := root["tools"].([]interface{}); ok {
+		for _, item := range arr {
+			tool, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			for _, key := range []string{"functionDeclarations", "function_declarations"} {
+				tools = append(tools, readTools(tool[key])...)
+			}
+		}
+	}
+	return segments, dedupe(tools)
+}
+
+func geminiResponse(root map[string]interface{}) ([]Segment, []string) {
+	var segments []Segment
+	var tools []string
+	candidates, _ := root["candidates"].([]interface{})
+	for i, item := range candidates {
+		candidate, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		content, ok := candidate["content"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		parts, _ := content["parts"].([]interface{})
+		role := geminiRole(content["role"])
+		if content["role"] == nil {
+			role = "assistant"
+		}
+		segments = append(segments, readParts(fmt.Sprintf("candidates[%d].content.parts", i), role, i, parts)...)
+		tools = append(tools, partToolNames(parts)...)
+	}
+	return segments, dedupe(tools)
+}
+
+func readParts(path, role string, index int, parts []interface{}) []Segment {
+	var out []Segment
+	for j, item := range parts {
+		part, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		partPath := fmt.Sprintf("%s[%d]", path, j)
+		if text, ok := part["text"].(string); ok {
+			out = append(out, Segment{Role: role, Index: index, PartType: "text", Path: partPath + ".text", Text: text})
+		}
+		if fr, ok := part["functionResponse"].(map[string]interface{}); ok {
+			if resp, ok := fr["response"]; ok {
+				out = append(out, Segment{Role: "tool", Index: index, PartType: "function_response", Path: partPath + ".functionResponse.response", Text: responseText(resp)})
+			}
+		}
+	}
+	return out
+}
+
+func partToolNames(parts []interface{}) []string {
+	var out []string
+	for _, item := range parts {
+		part, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if fc, ok := part["functionCall"].(map[string]interface{}); ok {
+			if name, ok := fc["name"].(string); ok {
+				out = append(out, name)
+			}
+		}
+	}
+	return out
+}
+
+func geminiRole(value interface{}) string {
+	role, _ := value.(string)
+	switch role {
+	case "", "user":
+		return "user"
+	case "model":
+		return "assistant"
+	case "function":
+		return "tool"
+	default:
+		return role
+	}
+}
+
+func responseText(value interface{}) string {
+	if str, ok := value.(string); ok {
+		return str
+	}
+	data, _ := json.Marshal(value)
+	return string(data)
+}
@@ -0,0 +1,175 @@
+package extract
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type Selector struct {
+	expr  string
+	steps []step
+}
+
+type step struct {
+	key    string
+	all    bool
+	index  int
+	filter *filter
+}
+
+type filter struct {
+	key   string
+	value string
+}
+
+func ParseSelector(expr string) (Selector, error) {
+	sel := Selector{expr: expr}
+	rest := strings.TrimSpace(expr)
+	rest = strings.TrimPrefix(rest, "$")
+	rest = strings.TrimPrefix(rest, ".")
+	if rest == "" {
+		return sel, fmt.Errorf("selector %q is empty", expr)
+	}
+	for rest != "" {
+		end := strings.IndexAny(rest, ".[")
+		if end == -1 {
+			end = len(rest)
+		}
+		if end > 0 {
+			sel.steps = append(sel.steps, step{key: rest[:end], index: -1})
+		}
+		rest = rest[end:]
+		for strings.HasPrefix(rest, "[") {
+			closing := strings.IndexByte(rest, ']')
+			if closing == -1 {
+				return sel, fmt.Errorf("selector %q has unclosed bracket", expr)
+			}
+			st, err := parseBracket(rest[1:closing])
+			if err != nil {
+				return sel, fmt.Errorf("selector %q: %w", expr, err)
+			}
+			sel.steps = append(sel.steps, st)
+			rest = rest[closing+1:]
+		}
+		if strings.HasPrefix(rest, ".") {
+			rest = rest[1:]
+			if rest == "" || strings.HasPrefix(rest, ".") || strings.HasPrefix(rest, "[") {
+				return sel, fmt.Errorf("selector %q has empty segment", expr)
+			}
+		} else if rest != "" {
+			return sel, fmt.Errorf("selector %q has unexpected %q", expr, rest)
+		}
+	}
+	return sel, nil
+}
+
+func MustParseSelector(expr string) Selector {
+	sel, err := ParseSelector(expr)
+	if err != nil {
+		panic(err)
+	}
+	return sel
+}
+
+func (s Selector) String() string {
+	return s.expr
+}
+
+func (s Selector) Values(root interface{}) []string {
+	nodes := []interface{}{root}
+	for _, st := range s.steps {
+		var next []interface{}
+		for _, node := range nodes {
+			next = append(next, st.apply(node)...)
+		}
+		nodes = next
+	}
+	var out []string
+	for _, node := range nodes {
+		out = append(out, flatten(node)...)
+	}
+	return out
+}
+
+func parseBracket(inner string) (step, error) {
+	inner = strings.TrimSpace(inner)
+	if inner == "" || inner == "*" {
+		return step{all: true, index: -1}, nil
+	}
+	if key, value, ok := strings.Cut(inner, "="); ok {
+		key = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(key), "@."))
+		value = strings.Trim(strings.TrimSpace(value), `"'`)
+		if key == "" {
+			return step{}, fmt.Errorf("filter %q missing key", inner)
+		}
+		return step{index: -1, filter: &filter{key: key, value: value}}, nil
+	}
+	index, err := strconv.Atoi(inner)
+	if err != nil || index < 0 {
+		return step{}, fmt.Errorf("invalid index %q", inner)
+	}
+	return step{index: index}, nil
+}
+
+func (st step) apply(node interface{}) []interface{} {
+	if st.key != "" {
+		obj, ok := node.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		val, ok := obj[st.key]
+		if !ok {
+			return nil
+		}
+		return []interface{}{val}
+	}
+	arr, ok := node.([]interface{})
+	if !ok {
+		return nil
+	}
+	if st.index >= 0 {
+		if st.index >= len(arr) {
+			return nil
+		}
+		return []interface{}{arr[st.index]}
+	}
+	if st.filter == nil {
+		return arr
+	}
+	var out []interface{}
+	for _, item := range arr {
+		obj, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if val, ok := obj[st.filter.key]; ok && fmt.Sprint(val) == st.filter.value {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+func flatten(node interface{}) []string {
+	switch val := node.(type) {
+	case nil:
+		return nil
+	case string:
+		return []string{val}
+	case []interface{}:
+		var out []string
+		for _, item := range val {
+			out = append(out, flatten(item)...)
+		}
+		return out
+	case map[string]interface{}:
+		if parts := readContent(val); len(parts) > 0 {
+			return parts
+		}
+		data, _ := json.Marshal(val)
+		return []string{string(data)}
+	default:
+		return []string{fmt.Sprint(val)}
+	}
+}
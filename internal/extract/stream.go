@@ -0,0 +1,315 @@
+package extract
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+)
+
+// ErrToolArgsTooLarge is returned by Add once a streamed tool call's
+// arguments grow past the limit set with LimitToolArgs.
+var ErrToolArgsTooLarge = errors.New("stream tool arguments too large")
+
+type Stream struct {
+	window    int
+	argsLimit int
+	format    Format
+	text      []byte
+	tools     []string
+	toolArgs  []string
+	toolIndex map[string]int
+	calls     []ToolCall
+	stale     []bool
+	overflow  bool
+}
+
+func NewStream(window int, format Format) *Stream {
+	return &Stream{window: window, format: format, toolIndex: map[string]int{}}
+}
+
+// LimitToolArgs caps the accumulated arguments of each tool call. Unlike
+// text, arguments are matched as a whole JSON document and cannot be windowed.
+func (s *Stream) LimitToolArgs(limit int) {
+	s.argsLimit = limit
+}
+
+func (s *Stream) Add(data []byte) error {
+	if err := s.add(data); err != nil {
+		return err
+	}
+	if s.overflow {
+		return ErrToolArgsTooLarge
+	}
+	return nil
+}
+
+func (s *Stream) add(data []byte) error {
+	root, err := parseRoot(data)
+	if err != nil {
+		return err
+	}
+	if s.format == FormatAuto {
+		if _, ok := root["choices"]; ok {
+			s.format = FormatOpenAI
+		} else if _, ok := root["candidates"]; ok {
+			s.format = FormatGemini
+		} else if _, ok := root["type"].(string); ok {
+			s.format = FormatAnthropic
+		}
+	}
+	switch s.format {
+	case FormatAnthropic:
+		s.addAnthropic(root)
+		return nil
+	case FormatGemini:
+		s.addGemini(root)
+		return nil
+	}
+	choices, _ := root["choices"].([]interface{})
+	for _, item := range choices {
+		choice, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if text, ok := choice["text"].(string); ok {
+			s.appendText(text)
+		}
+		delta, ok := choice["delta"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for _, part := range readContent(delta) {
+			s.appendText(part)
+		}
+		s.addToolDeltas(choice["index"], delta)
+	}
+	return nil
+}
+
+func (s *Stream) Result() Result {
+	var tools []string
+	var toolCalls []ToolCall
+	calls := []interface{}{}
+	for i, name := range s.tools {
+		if name == "" {
+			continue
+		}
+		if s.stale[i] {
+			s.calls[i] = streamToolCall(name, s.toolArgs[i], fmt.Sprintf("tool_calls[%d].arguments", i))
+			s.stale[i] = false
+		}
+		tools = append(tools, name)
+		toolCalls = append(toolCalls, s.calls[i])
+		calls = append(calls, map[string]interface{}{
+			"type":     "function",
+			"function": map[string]interface{}{"name": name, "arguments": s.toolArgs[i]},
+		})
+	}
+	var result Result
+	switch s.format {
+	case FormatAnthropic:
+		result = s.anthropicResult(tools)
+	case FormatGemini:
+		result = s.geminiResult(tools)
+	default:
+		result = s.openaiResult(tools, calls)
+	}
+	result.ToolCalls = toolCalls
+	return result
+}
+
+func (s *Stream) openaiResult(tools []string, calls []interface{}) Result {
+	root := map[string]interface{}{
+		"choices": []interface{}{
+			map[string]interface{}{
+				"message": map[string]interface{}{
+					"role":       "assistant",
+					"content":    string(s.text),
+					"tool_calls": calls,
+				},
+			},
+		},
+	}
+	var segments []Segment
+	if len(s.text) > 0 {
+		segments = append(segments, Segment{Role: "assistant", PartType: "text", Path: "choices[0].delta.content", Text: string(s.text)})
+	}
+	return Result{Text: string(s.text), ToolNames: dedupe(tools), Segments: segments, root: root}
+}
+
+func (s *Stream) addToolDeltas(choiceIndex interface{}, delta map[string]interface{}) {
+	if fn, ok := delta["function_call"].(map[string]interface{}); ok {
+		s.appendToolCall(fmt.Sprintf("%v/function_call", choiceIndex), fn, "arguments")
+	}
+	calls, ok := delta["tool_calls"].([]interface{})
+	if !ok {
+		return
+	}
+	for i, item := range calls {
+		call, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		index, ok := call["index"]
+		if !ok {
+			index = i
+		}
+		fn, ok := call["function"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		s.appendToolCall(fmt.Sprintf("%v/%v", choiceIndex, index), fn, "arguments")
+	}
+}
+
+func (s *Stream) appendToolCall(key string, fn map[string]interface{}, argsKey string) {
+	name, _ := fn["name"].(string)
+	var args string
+	switch val := fn[argsKey].(type) {
+	case nil:
+	case string:
+		args = val
+	default:
+		data, _ := json.Marshal(val)
+		args = string(data)
+	}
+	pos, ok := s.toolIndex[key]
+	if ok {
+		s.tools[pos] += name
+		s.toolArgs[pos] += args
+		s.stale[pos] = true
+	} else {
+		pos = len(s.tools)
+		s.toolIndex[key] = pos
+		s.tools = append(s.tools, name)
+		s.toolArgs = append(s.toolArgs, args)
+		s.calls = append(s.calls, ToolCall{})
+		s.stale = append(s.stale, true)
+	}
+	if s.argsLimit > 0 && len(s.toolArgs[pos]) > s.argsLimit {
+		s.overflow = true
+	}
+}
+
+// streamToolCall only parses arguments that can be a complete JSON document,
+// so partial arguments are not re-parsed on every event.
+func streamToolCall(name, args, path string) ToolCall {
+	trimmed := bytes.TrimSpace([]byte(args))
+	if len(trimmed) > 0 && !bytes.ContainsRune([]byte(`}]"`), rune(trimmed[len(trimmed)-1])) {
+		return ToolCall{Name: name, Raw: args, Arguments: args, Path: path}
+	}
+	return newToolCall("", name, args, false, path)
+}
+
+func (s *Stream) appendText(text string) {
+	s.text = append(s.text, text...)
+	if s.window <= 0 || len(s.text) <= s.window {
+		return
+	}
+	cut := len(s.text) - s.window
+	for cut < len(s.text) && !utf8.RuneStart(s.text[cut]) {
+		cut++
+	}
+	s.text = append(s.text[:0], s.text[cut:]...)
+}
+
+func (s *Stream) addAnthropic(root map[string]interface{}) {
+	switch root["type"] {
+	case "content_block_start":
+		block, ok := root["content_block"].(map[string]interface{})
+		if !ok {
+			return
+		}
+		switch block["type"] {
+		case "tool_use":
+			s.appendToolCall(fmt.Sprintf("block/%v", root["index"]), block, "")
+		case "text":
+			if text, ok := block["text"].(string); ok {
+				s.appendText(text)
+			}
+		}
+	case "content_block_delta":
+		delta, ok := root["delta"].(map[string]interface{})
+		if !ok {
+			return
+		}
+		switch delta["type"] {
+		case "text_delta":
+			if text, ok := delta["text"].(string); ok {
+				s.appendText(text)
+			}
+		case "input_json_delta":
+			key := fmt.Sprintf("block/%v", root["index"])
+			if _, ok := s.toolIndex[key]; ok {
+				s.appendToolCall(key, delta, "partial_json")
+			}
+		}
+	}
+}
+
+func (s *Stream) anthropicResult(tools []string) Result {
+	content := []interface{}{}
+	var segments []Segment
+	if len(s.text) > 0 {
+		content = append(content, map[string]interface{}{"type": "text", "text": string(s.text)})
+		segments = append(segments, Segment{Role: "assistant", PartType: "text", Path: "content[0].text", Text: string(s.text)})
+	}
+	for _, name := range tools {
+		content = append(content, map[string]interface{}{"type": "tool_use", "name": name})
+	}
+	root := map[string]interface{}{
+		"type":    "message",
+		"role":    "assistant",
+		"content": content,
+	}
+	return Result{Text: string(s.text), ToolNames: dedupe(tools), Segments: segments, root: root}
+}
+
+func (s *Stream) addGemini(root map[string]interface{}) {
+	candidates, _ := root["candidates"].([]interface{})
+	for i, item := range candidates {
+		candidate, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		content, ok := candidate["content"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		parts, _ := content["parts"].([]interface{})
+		for j, part := range parts {
+			obj, ok := part.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if text, ok := obj["text"].(string); ok {
+				s.appendText(text)
+			}
+			if fc, ok := obj["functionCall"].(map[string]interface{}); ok {
+				s.appendToolCall(fmt.Sprintf("candidate/%d/%d/%d", i, len(s.tools), j), fc, "args")
+			}
+		}
+	}
+}
+
+func (s *Stream) geminiResult(tools []string) Result {
+	parts := []interface{}{}
+	var segments []Segment
+	if len(s.text) > 0 {
+		parts = append(parts, map[string]interface{}{"text": string(s.text)})
+		segments = append(segments, Segment{Role: "assistant", PartType: "text", Path: "candidates[0].content.parts[0].text", Text: string(s.text)})
+	}
+	for _, name := range tools {
+		parts = append(parts, map[string]interface{}{"functionCall": map[string]interface{}{"name": name}})
+	}
+	root := map[string]interface{}{
+		"candidates": []interface{}{
+			map[string]interface{}{
+				"content": map[string]interface{}{"role": "model", "parts": parts},
+			},
+		},
+	}
+	return Result{Text: string(s.text), ToolNames: dedupe(tools), Segments: segments, root: root}
+}
@@ -0,0 +1,224 @@
+package extract
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+type ToolCall struct {
+	ID        string
+	Name      string
+	Arguments interface{}
+	Raw       string
+	Result    bool
+	Path      string
+}
+
+func (c ToolCall) Select(sel Selector) []string {
+	if c.Arguments == nil {
+		return nil
+	}
+	return sel.Values(c.Arguments)
+}
+
+func newToolCall(id, name string, args interface{}, result bool, path string) ToolCall {
+	call := ToolCall{ID: id, Name: name, Result: result, Path: path}
+	switch val := args.(type) {
+	case nil:
+	case string:
+		call.Raw = val
+		var parsed interface{}
+		if err := json.Unmarshal([]byte(val), &parsed); err == nil {
+			call.Arguments = parsed
+		} else {
+			call.Arguments = val
+		}
+	default:
+		data, _ := json.Marshal(val)
+		call.Raw = string(data)
+		call.Arguments = val
+	}
+	return call
+}
+
+func requestToolCalls(root map[string]interface{}, format Format) []ToolCall {
+	var calls []ToolCall
+	switch format {
+	case FormatAnthropic:
+		messages, _ := root["messages"].([]interface{})
+		for i, item := range messages {
+			msg, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			blocks, _ := msg["content"].([]interface{})
+			calls = append(calls, blockToolCalls(fmt.Sprintf("messages[%d].content", i), blocks)...)
+		}
+	case FormatGemini:
+		contents, _ := root["contents"].([]interface{})
+		for i, item := range contents {
+			content, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			parts, _ := content["parts"].([]interface{})
+			calls = append(calls, partToolCalls(fmt.Sprintf("contents[%d].parts", i), parts)...)
+		}
+	default:
+		for _, field := range []string{"messages", "input"} {
+			items, _ := root[field].([]interface{})
+			for i, item := range items {
+				msg, ok := item.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				calls = append(calls, messageToolCalls(fmt.Sprintf("%s[%d]", field, i), msg)...)
+			}
+		}
+	}
+	return nameResults(calls)
+}
+
+func responseToolCalls(root map[string]interface{}, format Format) []ToolCall {
+	var calls []ToolCall
+	switch format {
+	case FormatAnthropic:
+		blocks, _ := root["content"].([]interface{})
+		calls = blockToolCalls("content", blocks)
+	case FormatGemini:
+		candidates, _ := root["candidates"].([]interface{})
+		for i, item := range candidates {
+			candidate, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			content, _ := candidate["content"].(map[string]interface{})
+			parts, _ := content["parts"].([]interface{})
+			calls = append(calls, partToolCalls(fmt.Sprintf("candidates[%d].content.parts", i), parts)...)
+		}
+	default:
+		choices, _ := root["choices"].([]interface{})
+		for i, item := range choices {
+			choice, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if msg, ok := choice["message"].(map[string]interface{}); ok {
+				calls = append(calls, messageToolCalls(fmt.Sprintf("choices[%d].message", i), msg)...)
+			}
+		}
+		output, _ := root["output"].([]interface{})
+		for i, item := range output {
+			if obj, ok := item.(map[string]interface{}); ok {
+				calls = append(calls, messageToolCalls(fmt.Sprintf("output[%d]", i), obj)...)
+			}
+		}
+	}
+	return calls
+}
+
+func messageToolCalls(path string, msg map[string]interface{}) []ToolCall {
+	var out []ToolCall
+	if arr, ok := msg["tool_calls"].([]interface{}); ok {
+		for j, item := range arr {
+			call, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			fn, ok := call["function"].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			id, _ := call["id"].(string)
+			name, _ := fn["name"].(string)
+			out = append(out, newToolCall(id, name, fn["arguments"], false, fmt.Sprintf("%s.tool_calls[%d].function.arguments", path, j)))
+		}
+	}
+	if fn, ok := msg["function_call"].(map[string]interface{}); ok {
+		name, _ := fn["name"].(string)
+		out = append(out, newToolCall("", name, fn["arguments"], false, path+".function_call.arguments"))
+	}
+	switch msg["type"] {
+	case "function_call":
+		id, _ := msg["call_id"].(string)
+		name, _ := msg["name"].(string)
+		out = append(out, newToolCall(id, name, msg["arguments"], false, path+".arguments"))
+	case "function_call_output":
+		id, _ := msg["call_id"].(string)
+		out = append(out, newToolCall(id, "", msg["output"], true, path+".output"))
+	}
+	switch msg["role"] {
+	case "tool":
+		id, _ := msg["tool_call_id"].(string)
+		name, _ := msg["name"].(string)
+		out = append(out, newToolCall(id, name, contentValue(msg["content"]), true, path+".content"))
+	case "function":
+		name, _ := msg["name"].(string)
+		out = append(out, newToolCall("", name, contentValue(msg["content"]), true, path+".content"))
+	}
+	return out
+}
+
+func blockToolCalls(path string, blocks []interface{}) []ToolCall {
+	var out []ToolCall
+	for j, item := range blocks {
+		block, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		blockPath := fmt.Sprintf("%s[%d]", path, j)
+		switch block["type"] {
+		case "tool_use":
+			id, _ := block["id"].(string)
+			name, _ := block["name"].(string)
+			out = append(out, newToolCall(id, name, block["input"], false, blockPath+".input"))
+		case "tool_result":
+			id, _ := block["tool_use_id"].(string)
+			out = append(out, newToolCall(id, "", contentValue(block["content"]), true, blockPath+".content"))
+		}
+	}
+	return out
+}
+
+func partToolCalls(path string, parts []interface{}) []ToolCall {
+	var out []ToolCall
+	for j, item := range parts {
+		part, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		partPath := fmt.Sprintf("%s[%d]", path, j)
+		if fc, ok := part["functionCall"].(map[string]interface{}); ok {
+			name, _ := fc["name"].(string)
+			out = append(out, newToolCall("", name, fc["args"], false, partPath+".functionCall.args"))
+		}
+		if fr, ok := part["functionResponse"].(map[string]interface{}); ok {
+			name, _ := fr["name"].(string)
+			out = append(out, newToolCall("", name, fr["response"], true, partPath+".functionResponse.response"))
+		}
+	}
+	return out
+}
+
+func contentValue(content interface{}) interface{} {
+	arr, ok := content.([]interface{})
+	if !ok {
+		return content
+	}
+	return join(readContentArray(arr))
+}
+
+func nameResults(calls []ToolCall) []ToolCall {
+	names := map[string]string{}
+	for _, call := range calls {
+		if !call.Result && call.ID != "" {
+			names[call.ID] = call.Name
+		}
+	}
+	for i, call := range calls {
+		if call.Result && call.Name == "" && call.ID != "" {
+			calls[i].Name = names[call.ID]
+		}
+	}
+	return calls
+}
@@ -0,0 +1,117 @@
+package policy
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"prompt-injection-firewall/internal/config"
+	"prompt-injection-firewall/internal/extract"
+)
+
+type compiledArg struct {
+	config.ArgMatch
+	pattern *regexp.Regexp
+	glob    *regexp.Regexp
+	arg     *extract.Selector
+}
+
+func compileArgs(args []config.ArgMatch) ([]compiledArg, error) {
+	out := make([]compiledArg, 0, len(args))
+	for _, arg := range args {
+		ca := compiledArg{ArgMatch: arg}
+		if arg.Pattern != "" {
+			pattern, err := regexp.Compile(arg.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("tool_args has invalid pattern: %w", err)
+			}
+			ca.pattern = pattern
+		}
+		if arg.Glob != "" {
+			ca.glob = globRegexp(arg.Glob)
+		}
+		if arg.Arg != "" {
+			sel, err := extract.ParseSelector(arg.Arg)
+			if err != nil {
+				return nil, fmt.Errorf("tool_args has invalid arg: %w", err)
+			}
+			ca.arg = &sel
+		}
+		out = append(out, ca)
+	}
+	return out, nil
+}
+
+func matchToolArgs(args []compiledArg, calls []extract.ToolCall) bool {
+	for _, arg := range args {
+		for _, call := range calls {
+			if arg.matches(call) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (a compiledArg) matches(call extract.ToolCall) bool {
+	if a.Tool != "" && !strings.EqualFold(a.Tool, call.Name) {
+		return false
+	}
+	switch strings.ToLower(a.Source) {
+	case "", "call":
+		if call.Result {
+			return false
+		}
+	case "result":
+		if !call.Result {
+			return false
+		}
+	}
+	var values []string
+	if a.arg != nil {
+		values = call.Select(*a.arg)
+	} else if call.Raw != "" {
+		values = []string{call.Raw}
+	}
+	for _, value := range values {
+		if a.pattern != nil && !a.pattern.MatchString(value) {
+			continue
+		}
+		if a.glob != nil && !a.glob.MatchString(cleanPath(value)) {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+func globRegexp(glob string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("^")
+	runes := []rune(glob)
+	for i := 0; i < len(runes); i++ {
+		switch c := runes[i]; c {
+		case '*':
+			if i+1 < len(runes) && runes[i+1] == '*' {
+				b.WriteString(".*")
+				i++
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
+func cleanPath(value string) string {
+	if value == "" {
+		return value
+	}
+	return path.Clean(value)
+}
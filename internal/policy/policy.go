@@ -1,10 +1,12 @@
 package policy
 
 import (
+	"fmt"
 	"regexp"
 	"strings"
 
 	"prompt-injection-firewall/internal/config"
+	"prompt-injection-firewall/internal/extract"
 )
 
 type Decision string
@@ -16,29 +18,47 @@ const (
 )
 
 type Result struct {
-	Decision Decision
+	Decision      Decision
+	RuleName      string
+	Reason        string
+	Score         float64
+	Contributions []Contribution
+	WouldDecision Decision
+	WouldRule     string
+}
+
+type Contribution struct {
 	RuleName string
-	Reason   string
+	Score    float64
 }
 
 type Evaluator struct {
-	rules []compiledRule
-	order []Decision
+	rules   []compiledRule
+	order   []Decision
+	scoring *config.Scoring
 }
 
 type compiledRule struct {
 	config.Rule
+	match compiledMatch
+}
+
+type compiledMatch struct {
+	config.Match
 	pattern *regexp.Regexp
+	field   *extract.Selector
+	args    []compiledArg
+	all     []compiledMatch
+	any     []compiledMatch
+	not     *compiledMatch
 }
 
+// NewEvaluator compiles rules that are known to be valid and panics on
+// one that is not; Compile reports the error instead.
 func NewEvaluator(rules []config.Rule, order []string) *Evaluator {
-	compiled := make([]compiledRule, 0, len(rules))
-	for _, rule := range rules {
-		cr := compiledRule{Rule: rule}
-		if rule.Match.Pattern != "" {
-			cr.pattern = regexp.MustCompile(rule.Match.Pattern)
-		}
-		compiled = append(compiled, cr)
+	compiled, err := compileRules(rules)
+	if err != nil {
+		panic(err)
 	}
 	return &Evaluator{
 		rules: compiled,
@@ -46,6 +66,56 @@ func NewEvaluator(rules []config.Rule, order []string) *Evaluator {
 	}
 }
 
+// Compile builds the evaluator for a loaded config, rejecting patterns and
+// selectors that do not parse.
+func Compile(cfg config.Config) (*Evaluator, error) {
+	compiled, err := compileRules(cfg.Rules)
+	if err != nil {
+		return nil, err
+	}
+	e := &Evaluator{
+		rules: compiled,
+		order: parseOrder(cfg.DecisionOrder),
+	}
+	if cfg.Scoring.Enabled {
+		scoring := cfg.Scoring
+		e.scoring = &scoring
+	}
+	return e, nil
+}
+
+// FromConfig is Compile for configs known to be valid, such as test fixtures.
+func FromConfig(cfg config.Config) *Evaluator {
+	e, err := Compile(cfg)
+	if err != nil {
+		panic(err)
+	}
+	return e
+}
+
+func compileRules(rules []config.Rule) ([]compiledRule, error) {
+	compiled := make([]compiledRule, 0, len(rules))
+	for _, rule := range rules {
+		match, err := compileMatch(rule.Match, "match")
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %w", rule.Name, err)
+		}
+		compiled = append(compiled, compiledRule{Rule: rule, match: match})
+	}
+	return compiled, nil
+}
+
+func (r Result) ScoreRules() []string {
+	if len(r.Contributions) == 0 {
+		return nil
+	}
+	out := make([]string, 0, len(r.Contributions))
+	for _, c := range r.Contributions {
+		out = append(out, c.RuleName)
+	}
+	return out
+}
+
 func parseOrder(order []string) []Decision {
 	out := make([]Decision, 0, len(order))
 	for _, item := range order {
@@ -65,24 +135,155 @@ func parseOrder(order []string) []Decision {
 }
 
 func (e *Evaluator) Evaluate(stage string, text string, toolNames []string) Result {
+	return e.EvaluateResult(stage, extract.Result{Text: text, ToolNames: toolNames})
+}
+
+func (e *Evaluator) EvaluateResult(stage string, input extract.Result) Result {
 	stage = strings.ToLower(stage)
+	res := e.evaluate(stage, input, false)
+	if !e.hasMonitorRules(stage) {
+		return res
+	}
+	would := e.evaluate(stage, input, true)
+	if would.Decision != res.Decision || would.RuleName != res.RuleName {
+		res.WouldDecision = would.Decision
+		res.WouldRule = would.RuleName
+	}
+	return res
+}
+
+func (e *Evaluator) evaluate(stage string, input extract.Result, monitor bool) Result {
+	if e.scoring != nil {
+		return e.score(stage, input, monitor)
+	}
 	for _, decision := range e.order {
-		if res, ok := e.matchStage(stage, text, toolNames, decision); ok {
+		if res, ok := e.matchStage(stage, input, decision, monitor); ok {
 			return res
 		}
 	}
 	return Result{Decision: DecisionAllow, Reason: "no_matching_rule"}
 }
 
-func (e *Evaluator) matchStage(stage string, text string, toolNames []string, decision Decision) (Result, bool) {
+// score adds up weighted rules and then lets unweighted action rules
+// decide first-match as usual; the stricter of the two outcomes under the
+// decision order wins, so enabling scoring never disables a deny rule.
+func (e *Evaluator) score(stage string, input extract.Result, monitor bool) Result {
+	res := e.scoreTotal(stage, input, monitor)
+	for _, decision := range e.order {
+		if e.rank(decision) > e.rank(res.Decision) {
+			break
+		}
+		if matched, ok := e.matchStage(stage, input, decision, monitor); ok {
+			matched.Score, matched.Contributions = res.Score, res.Contributions
+			return matched
+		}
+	}
+	return res
+}
+
+func (e *Evaluator) rank(decision Decision) int {
+	for i, d := range e.order {
+		if d == decision {
+			return i
+		}
+	}
+	return len(e.order)
+}
+
+func (e *Evaluator) scoreTotal(stage string, input extract.Result, monitor bool) Result {
+	res := Result{Decision: DecisionAllow, Reason: "below_threshold"}
+	top := 0.0
+	for _, rule := range e.rules {
+		if strings.ToLower(rule.Stage) != stage || rule.Score == 0 {
+			continue
+		}
+		if rule.monitor() && !monitor {
+			continue
+		}
+		if !matches(rule, input) {
+			continue
+		}
+		res.Score += rule.Score
+		res.Contributions = append(res.Contributions, Contribution{RuleName: rule.Name, Score: rule.Score})
+		if rule.Score > top {
+			top = rule.Score
+			res.RuleName = rule.Name
+		}
+	}
+	thresholds := e.scoring.Thresholds
+	switch {
+	case thresholds.Deny > 0 && res.Score >= thresholds.Deny:
+		res.Decision, res.Reason = DecisionDeny, "score_threshold"
+	case thresholds.Approve > 0 && res.Score >= thresholds.Approve:
+		res.Decision, res.Reason = DecisionApprove, "score_threshold"
+	}
+	return res
+}
+
+func (e *Evaluator) hasMonitorRules(stage string) bool {
+	for _, rule := range e.rules {
+		if strings.ToLower(rule.Stage) == stage && rule.monitor() {
+			return true
+		}
+	}
+	return false
+}
+
+func (r compiledRule) monitor() bool {
+	return strings.EqualFold(r.Mode, "monitor")
+}
+
+func (e *Evaluator) HasStage(stage string) bool {
+	stage = strings.ToLower(stage)
+	for _, rule := range e.rules {
+		if strings.ToLower(rule.Stage) == stage {
+			return true
+		}
+	}
+	return false
+}
+
+// Patterns returns the compiled patterns of the named rule, including those
+// nested under all and any, for highlighting what a rule looks for.
+func (e *Evaluator) Patterns(ruleName string) []*regexp.Regexp {
+	var out []*regexp.Regexp
+	for _, rule := range e.rules {
+		if rule.Name == ruleName {
+			out = append(out, rule.match.patterns()...)
+		}
+	}
+	return out
+}
+
+func (m compiledMatch) patterns() []*regexp.Regexp {
+	var out []*regexp.Regexp
+	if m.pattern != nil {
+		out = append(out, m.pattern)
+	}
+	for _, child := range m.all {
+		out = append(out, child.patterns()...)
+	}
+	for _, child := range m.any {
+		out = append(out, child.patterns()...)
+	}
+	return out
+}
+
+func (e *Evaluator) matchStage(stage string, input extract.Result, decision Decision, monitor bool) (Result, bool) {
 	for _, rule := range e.rules {
 		if strings.ToLower(rule.Stage) != stage {
 			continue
 		}
+		if rule.monitor() && !monitor {
+			continue
+		}
 		if strings.ToLower(rule.Action) != string(decision) {
 			continue
 		}
-		if !matches(rule, text, toolNames) {
+		if e.scoring != nil && rule.Score != 0 {
+			continue
+		}
+		if !matches(rule, input) {
 			continue
 		}
 		return Result{
@@ -94,20 +295,117 @@ func (e *Evaluator) matchStage(stage string, text string, toolNames []string, de
 	return Result{}, false
 }
 
-func matches(rule compiledRule, text string, toolNames []string) bool {
-	if rule.Match.Pattern != "" && rule.pattern != nil {
-		if !rule.pattern.MatchString(text) {
+func compileMatch(m config.Match, path string) (compiledMatch, error) {
+	cm := compiledMatch{Match: m}
+	if m.Pattern != "" {
+		pattern, err := regexp.Compile(m.Pattern)
+		if err != nil {
+			return cm, fmt.Errorf("%s has invalid pattern: %w", path, err)
+		}
+		cm.pattern = pattern
+	}
+	if m.Field != "" {
+		sel, err := extract.ParseSelector(m.Field)
+		if err != nil {
+			return cm, fmt.Errorf("%s has invalid field: %w", path, err)
+		}
+		cm.field = &sel
+	}
+	args, err := compileArgs(m.ToolArgs)
+	if err != nil {
+		return cm, fmt.Errorf("%s: %w", path, err)
+	}
+	cm.args = args
+	for i, child := range m.All {
+		compiled, err := compileMatch(child, fmt.Sprintf("%s.all[%d]", path, i))
+		if err != nil {
+			return cm, err
+		}
+		cm.all = append(cm.all, compiled)
+	}
+	for i, child := range m.Any {
+		compiled, err := compileMatch(child, fmt.Sprintf("%s.any[%d]", path, i))
+		if err != nil {
+			return cm, err
+		}
+		cm.any = append(cm.any, compiled)
+	}
+	if m.Not != nil {
+		not, err := compileMatch(*m.Not, path+".not")
+		if err != nil {
+			return cm, err
+		}
+		cm.not = &not
+	}
+	return cm, nil
+}
+
+func matches(rule compiledRule, input extract.Result) bool {
+	return rule.match.eval(input)
+}
+
+func (m compiledMatch) eval(input extract.Result) bool {
+	if m.field != nil {
+		if !m.matchValues(input.Select(*m.field)) {
+			return false
+		}
+	} else if len(m.Roles) > 0 {
+		if !m.matchValues(input.TextForRoles(m.Roles)) {
+			return false
+		}
+	} else if m.pattern != nil {
+		if !m.pattern.MatchString(input.Text) {
 			return false
 		}
 	}
-	if len(rule.Match.ToolNames) > 0 {
-		if !hasAnyTool(toolNames, rule.Match.ToolNames) {
+	if len(m.ToolNames) > 0 {
+		if !hasAnyTool(input.ToolNames, m.ToolNames) {
 			return false
 		}
 	}
+	if len(m.args) > 0 {
+		if !matchToolArgs(m.args, input.ToolCalls) {
+			return false
+		}
+	}
+	for _, child := range m.all {
+		if !child.eval(input) {
+			return false
+		}
+	}
+	if len(m.any) > 0 {
+		matched := false
+		for _, child := range m.any {
+			if child.eval(input) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if m.not != nil && m.not.eval(input) {
+		return false
+	}
 	return true
 }
 
+func (m compiledMatch) matchValues(values []string) bool {
+	if len(values) == 0 {
+		return false
+	}
+	if m.pattern == nil {
+		return true
+	}
+	for _, value := range values {
+		if m.pattern.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
 func hasAnyTool(tools []string, wanted []string) bool {
 	lookup := make(map[string]struct{}, len(tools))
 	for _, tool := range tools {
@@ -0,0 +1,138 @@
+package policytest
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+
+	"prompt-injection-firewall/internal/config"
+	"prompt-injection-firewall/internal/policy"
+	"prompt-injection-firewall/internal/proxy"
+)
+
+type Suite struct {
+	Cases []Case `yaml:"cases"`
+}
+
+type Case struct {
+	Name     string      `yaml:"name"`
+	Stage    string      `yaml:"stage"`
+	Path     string      `yaml:"path"`
+	Body     interface{} `yaml:"body"`
+	BodyFile string      `yaml:"body_file"`
+	Expect   Expect      `yaml:"expect"`
+	File     string      `yaml:"-"`
+	body     []byte
+}
+
+type Expect struct {
+	Decision string  `yaml:"decision"`
+	Rule     *string `yaml:"rule"`
+	Reason   *string `yaml:"reason"`
+}
+
+type Diff struct {
+	Field string `json:"field"`
+	Want  string `json:"want"`
+	Got   string `json:"got"`
+}
+
+type Result struct {
+	Name    string        `json:"name"`
+	File    string        `json:"file"`
+	Verdict proxy.Verdict `json:"verdict"`
+	Diffs   []Diff        `json:"diffs,omitempty"`
+}
+
+func (r Result) Passed() bool {
+	return len(r.Diffs) == 0
+}
+
+func Load(path string) ([]Case, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var suite Suite
+	if err := yaml.Unmarshal(data, &suite); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(suite.Cases) == 0 {
+		return nil, fmt.Errorf("%s: no cases", path)
+	}
+	for i := range suite.Cases {
+		c := &suite.Cases[i]
+		c.File = path
+		if c.Name == "" {
+			c.Name = fmt.Sprintf("case %d", i+1)
+		}
+		if err := c.prepare(filepath.Dir(path)); err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", path, c.Name, err)
+		}
+	}
+	return suite.Cases, nil
+}
+
+func (c *Case) prepare(dir string) error {
+	if c.Stage == "" {
+		c.Stage = "request"
+	}
+	if c.Stage != "request" && c.Stage != "response" {
+		return fmt.Errorf("unknown stage %q", c.Stage)
+	}
+	if c.Path == "" {
+		c.Path = "/v1/chat/completions"
+	}
+	switch policy.Decision(c.Expect.Decision) {
+	case policy.DecisionAllow, policy.DecisionDeny, policy.DecisionApprove:
+	default:
+		return fmt.Errorf("expect.decision must be allow, deny or approve, got %q", c.Expect.Decision)
+	}
+	if (c.Body == nil) == (c.BodyFile == "") {
+		return fmt.Errorf("exactly one of body and body_file is required")
+	}
+	if c.BodyFile != "" {
+		file := c.BodyFile
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(dir, file)
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		c.body = data
+		return nil
+	}
+	if text, ok := c.Body.(string); ok {
+		c.body = []byte(text)
+		return nil
+	}
+	data, err := json.Marshal(c.Body)
+	if err != nil {
+		return fmt.Errorf("body: %w", err)
+	}
+	c.body = data
+	return nil
+}
+
+func Run(cfg config.Config, evaluator *policy.Evaluator, cases []Case) []Result {
+	results := make([]Result, 0, len(cases))
+	for _, c := range cases {
+		verdict := proxy.Evaluate(cfg, evaluator, c.Stage, c.Path, c.body)
+		result := Result{Name: c.Name, File: c.File, Verdict: verdict}
+		result.check("decision", &c.Expect.Decision, verdict.Decision)
+		result.check("rule", c.Expect.Rule, verdict.RuleName)
+		result.check("reason", c.Expect.Reason, verdict.Reason)
+		results = append(results, result)
+	}
+	return results
+}
+
+func (r *Result) check(field string, want *string, got string) {
+	if want != nil && *want != got {
+		r.Diffs = append(r.Diffs, Diff{Field: field, Want: *want, Got: got})
+	}
+}
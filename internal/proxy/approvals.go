@@ -0,0 +1,375 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"prompt-injection-firewall/internal/approval"
+	"prompt-injection-firewall/internal/audit"
+	"prompt-injection-firewall/internal/config"
+	"prompt-injection-firewall/internal/policy"
+	"prompt-injection-firewall/internal/ui"
+	"prompt-injection-firewall/internal/webhook"
+)
+
+var (
+	errAlreadyApproved = errors.New("approver already approved")
+	errApproverRole    = errors.New("approver lacks a required role")
+	errGrantQuorum     = errors.New("grants need a single-approver rule")
+	errGrantScope      = errors.New("grant scope is empty for this request")
+	errSharedQuorum    = errors.New("shared token cannot vote toward a quorum")
+)
+
+const sharedApprover = "shared"
+
+type approvalSummary struct {
+	ID             string          `json:"id"`
+	RequestID      string          `json:"request_id"`
+	Stage          string          `json:"stage,omitempty"`
+	RuleName       string          `json:"rule_name,omitempty"`
+	Reason         string          `json:"reason,omitempty"`
+	ToolNames      []string        `json:"tool_names,omitempty"`
+	TextSample     string          `json:"text_sample,omitempty"`
+	SampleSegments []sampleSegment `json:"sample_segments,omitempty"`
+	Method         string          `json:"method"`
+	Path           string          `json:"path"`
+	Status         string          `json:"status"`
+	Quorum         int             `json:"quorum,omitempty"`
+	Approvers      []string        `json:"approvers,omitempty"`
+	Comment        string          `json:"comment,omitempty"`
+	Created        time.Time       `json:"created"`
+	Expires        time.Time       `json:"expires"`
+}
+
+type approvalDetail struct {
+	approvalSummary
+	Header   http.Header      `json:"header"`
+	Body     json.RawMessage  `json:"body"`
+	Response *approvalPreview `json:"response,omitempty"`
+}
+
+type approvalPreview struct {
+	Status int             `json:"status"`
+	Body   json.RawMessage `json:"body"`
+}
+
+func (s *Server) handleApprovals(w http.ResponseWriter, r *http.Request) {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/approvals"), "/")
+	parts := strings.Split(rest, "/")
+	if len(parts) == 2 && parts[1] == "result" {
+		if !s.cfg.Approval.Enabled {
+			writeError(w, http.StatusNotFound, "approval_disabled")
+			return
+		}
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, "method_not_allowed")
+			return
+		}
+		s.handleResult(w, r, parts[0])
+		return
+	}
+	who, ok := s.authorizeApproval(w, r)
+	if !ok {
+		return
+	}
+	if parts[0] == "grants" {
+		s.handleGrants(w, r, parts[1:], who)
+		return
+	}
+	switch {
+	case rest == "":
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, "method_not_allowed")
+			return
+		}
+		s.listApprovals(w)
+	case len(parts) == 1:
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, "method_not_allowed")
+			return
+		}
+		s.showApproval(w, r, parts[0], who)
+	case len(parts) == 2 && (parts[1] == "approve" || parts[1] == "reject"):
+		if r.Method != http.MethodPost {
+			writeError(w, http.StatusMethodNotAllowed, "method_not_allowed")
+			return
+		}
+		comment, spec, err := readDecision(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_body")
+			return
+		}
+		if parts[1] == "approve" {
+			s.approve(w, r, parts[0], who, comment, spec)
+			return
+		}
+		s.reject(w, r, parts[0], who, comment)
+	default:
+		writeError(w, http.StatusNotFound, "not_found")
+	}
+}
+
+func (s *Server) authorizeApproval(w http.ResponseWriter, r *http.Request) (config.Approver, bool) {
+	if !s.cfg.Approval.Enabled {
+		writeError(w, http.StatusNotFound, "approval_disabled")
+		return config.Approver{}, false
+	}
+	token := r.Header.Get("X-Approval-Token")
+	for _, approver := range s.cfg.Approval.Approvers {
+		if tokenEqual(token, approver.Token) {
+			return approver, true
+		}
+	}
+	if s.cfg.Approval.Token != "" {
+		if !tokenEqual(token, s.cfg.Approval.Token) {
+			writeError(w, http.StatusUnauthorized, "invalid_token")
+			return config.Approver{}, false
+		}
+		return config.Approver{Name: sharedApprover}, true
+	}
+	if len(s.cfg.Approval.Approvers) > 0 {
+		writeError(w, http.StatusUnauthorized, "invalid_token")
+		return config.Approver{}, false
+	}
+	return config.Approver{}, true
+}
+
+func tokenEqual(got, want string) bool {
+	return want != "" && subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1
+}
+
+func (s *Server) listApprovals(w http.ResponseWriter) {
+	items, err := s.pending.List()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "approval_store_error")
+		return
+	}
+	out := make([]approvalSummary, 0, len(items))
+	for _, item := range items {
+		out = append(out, s.summarize(item))
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"approvals": out,
+	})
+}
+
+func (s *Server) showApproval(w http.ResponseWriter, r *http.Request, id string, who config.Approver) {
+	pending, ok, err := s.pending.Get(id)
+	if !s.pendingFound(w, ok, err) {
+		return
+	}
+	detail := approvalDetail{
+		approvalSummary: s.summarize(pending),
+		Header:          redactHeader(pending.Header),
+		Body:            redactBody(pending.Body),
+	}
+	if pending.Response != nil {
+		detail.Response = &approvalPreview{
+			Status: pending.Response.Status,
+			Body:   redactBody(pending.Response.Body),
+		}
+	}
+	writeJSON(w, http.StatusOK, detail)
+	s.logEvent(audit.Event{
+		Time:          time.Now().Format(s.cfg.TimeFormat),
+		RequestID:     pending.RequestID,
+		RemoteAddr:    r.RemoteAddr,
+		Method:        pending.Method,
+		Path:          pending.Path,
+		Stage:         pending.Stage,
+		RuleName:      "approval_handler",
+		Reason:        "approval_viewed",
+		Upstream:      s.cfg.Upstream,
+		ApprovalID:    id,
+		Approver:      who.Name,
+		ApproverRoles: who.Roles,
+	})
+}
+
+func readDecision(r *http.Request) (string, *grantSpec, error) {
+	body, err := readBody(r, 1024*16)
+	if err != nil || len(bytes.TrimSpace(body)) == 0 {
+		return "", nil, err
+	}
+	var payload struct {
+		Reason  string     `json:"reason"`
+		Comment string     `json:"comment"`
+		Grant   *grantSpec `json:"grant"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return "", nil, err
+	}
+	if payload.Reason != "" {
+		return payload.Reason, payload.Grant, nil
+	}
+	return payload.Comment, payload.Grant, nil
+}
+
+func (s *Server) reject(w http.ResponseWriter, r *http.Request, id string, who config.Approver, comment string) {
+	pending, ok := s.decide(w, id, who, comment)
+	if !ok {
+		return
+	}
+	s.secrets.drop(id)
+	s.waiters.notify(id)
+	s.notify(webhook.EventRejected, pending, who.Name)
+	writeJSON(w, http.StatusOK, map[string]string{
+		"approval_id": id,
+		"status":      "rejected",
+	})
+	s.logEvent(audit.Event{
+		Time:          time.Now().Format(s.cfg.TimeFormat),
+		RequestID:     pending.RequestID,
+		RemoteAddr:    r.RemoteAddr,
+		Method:        pending.Method,
+		Path:          pending.Path,
+		Stage:         pending.Stage,
+		Decision:      string(policy.DecisionDeny),
+		RuleName:      "approval_handler",
+		Reason:        "rejected",
+		Comment:       comment,
+		Upstream:      s.cfg.Upstream,
+		ApprovalID:    id,
+		Approver:      who.Name,
+		ApproverRoles: who.Roles,
+		Approvers:     pending.Approvers(),
+		StatusCode:    http.StatusOK,
+	})
+}
+
+func (s *Server) vote(w http.ResponseWriter, id string, who config.Approver, comment string, spec *grantSpec) (approval.Request, bool) {
+	now := time.Now()
+	pending, ok, err := s.pending.Update(id, func(req *approval.Request) error {
+		if err := checkVoter(req, who); err != nil {
+			return err
+		}
+		if req.Quorum > 1 && who.Name == sharedApprover && len(s.cfg.Approval.Approvers) > 0 {
+			return errSharedQuorum
+		}
+		if spec != nil {
+			if req.Quorum > 1 {
+				return errGrantQuorum
+			}
+			if _, ok := spec.build(*req, now); !ok {
+				return errGrantScope
+			}
+		}
+		for _, vote := range req.Votes {
+			if vote.Approver == who.Name {
+				return errAlreadyApproved
+			}
+		}
+		req.Votes = append(req.Votes, approval.Vote{Approver: who.Name, Roles: who.Roles, Comment: comment, Time: now})
+		if len(req.Votes) >= req.Quorum {
+			req.Status = approval.StatusApproved
+			req.Decided = now
+			req.Retain = now.Add(s.cfg.Approval.TTL)
+		}
+		return nil
+	})
+	if !s.pendingFound(w, ok, err) {
+		return approval.Request{}, false
+	}
+	return pending, true
+}
+
+func (s *Server) decide(w http.ResponseWriter, id string, who config.Approver, comment string) (approval.Request, bool) {
+	now := time.Now()
+	pending, ok, err := s.pending.Update(id, func(req *approval.Request) error {
+		if err := checkVoter(req, who); err != nil {
+			return err
+		}
+		req.Status = approval.StatusRejected
+		req.Comment = comment
+		req.Decided = now
+		req.Retain = now.Add(s.cfg.Approval.TTL)
+		return nil
+	})
+	if !s.pendingFound(w, ok, err) {
+		return approval.Request{}, false
+	}
+	return pending, true
+}
+
+func checkVoter(req *approval.Request, who config.Approver) error {
+	if req.Status != approval.StatusPending {
+		return approval.ErrNotPending
+	}
+	if !who.HasAnyRole(req.Roles) {
+		return errApproverRole
+	}
+	return nil
+}
+
+func (s *Server) resolve(id string, result approval.Response) {
+	_, _, _ = s.pending.Update(id, func(req *approval.Request) error {
+		req.Result = &result
+		return nil
+	})
+	s.secrets.drop(id)
+	s.waiters.notify(id)
+}
+
+func (s *Server) pendingFound(w http.ResponseWriter, ok bool, err error) bool {
+	switch {
+	case errors.Is(err, approval.ErrInvalidID):
+		writeError(w, http.StatusBadRequest, "invalid_approval_id")
+	case errors.Is(err, approval.ErrNotPending):
+		writeError(w, http.StatusConflict, "approval_not_pending")
+	case errors.Is(err, errAlreadyApproved):
+		writeError(w, http.StatusConflict, "already_approved")
+	case errors.Is(err, errApproverRole):
+		writeError(w, http.StatusForbidden, "approver_role_required")
+	case errors.Is(err, errSharedQuorum):
+		writeError(w, http.StatusForbidden, "named_approver_required")
+	case errors.Is(err, errGrantQuorum):
+		writeError(w, http.StatusConflict, "grant_needs_single_approver")
+	case errors.Is(err, errGrantScope):
+		writeError(w, http.StatusConflict, "grant_scope_unavailable")
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, "approval_store_error")
+	case !ok:
+		writeError(w, http.StatusNotFound, "approval_not_found")
+	default:
+		return true
+	}
+	return false
+}
+
+func (s *Server) summarize(req approval.Request) approvalSummary {
+	return approvalSummary{
+		SampleSegments: s.highlight(req.RuleName, req.TextSample),
+		ID:             req.ID,
+		RequestID:      req.RequestID,
+		Stage:          req.Stage,
+		RuleName:       req.RuleName,
+		Reason:         req.Reason,
+		ToolNames:      req.ToolNames,
+		TextSample:     req.TextSample,
+		Method:         req.Method,
+		Path:           req.Path,
+		Status:         req.Status,
+		Quorum:         req.Quorum,
+		Approvers:      req.Approvers(),
+		Comment:        req.Comment,
+		Created:        req.Created,
+		Expires:        req.Expires,
+	}
+}
+
+func (s *Server) isUIPath(path string) bool {
+	prefix := s.cfg.Approval.UIPath
+	if !s.cfg.Approval.Enabled || prefix == "" {
+		return false
+	}
+	return strings.HasPrefix(path, prefix) || path == strings.TrimSuffix(prefix, "/")
+}
+
+func (s *Server) handleUI(w http.ResponseWriter, r *http.Request) {
+	ui.Handler(s.cfg.Approval.UIPath).ServeHTTP(w, r)
+}
@@ -0,0 +1,70 @@
+package proxy
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// credentials holds the sensitive headers of held requests in memory, so
+// the approval store never writes upstream keys to disk. They are lost on
+// restart, and a request released afterwards goes upstream without them.
+type credentials struct {
+	mu      sync.Mutex
+	headers map[string]heldCredentials
+}
+
+type heldCredentials struct {
+	header  http.Header
+	expires time.Time
+}
+
+func newCredentials() *credentials {
+	return &credentials{headers: make(map[string]heldCredentials)}
+}
+
+// splitCredentials returns header without its sensitive keys, and those keys apart.
+func splitCredentials(header http.Header) (http.Header, http.Header) {
+	rest, secret := http.Header{}, http.Header{}
+	for key, values := range header {
+		if isSensitiveKey(key) {
+			secret[key] = append([]string(nil), values...)
+			continue
+		}
+		rest[key] = append([]string(nil), values...)
+	}
+	return rest, secret
+}
+
+func (c *credentials) put(id string, header http.Header, expires time.Time) {
+	if len(header) == 0 {
+		return
+	}
+	c.mu.Lock()
+	c.headers[id] = heldCredentials{header: header, expires: expires}
+	c.mu.Unlock()
+}
+
+func (c *credentials) get(id string) http.Header {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.headers[id].header
+}
+
+func (c *credentials) drop(id string) {
+	c.mu.Lock()
+	delete(c.headers, id)
+	c.mu.Unlock()
+}
+
+// prune drops the headers of requests that can no longer be approved,
+// including those a store settled as expired on read.
+func (c *credentials) prune(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id, held := range c.headers {
+		if now.After(held.expires) {
+			delete(c.headers, id)
+		}
+	}
+}
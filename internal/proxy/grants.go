@@ -0,0 +1,150 @@
+package proxy
+
+import (
+	"net/http"
+	"time"
+
+	"prompt-injection-firewall/internal/approval"
+	"prompt-injection-firewall/internal/audit"
+	"prompt-injection-firewall/internal/config"
+	"prompt-injection-firewall/internal/policy"
+)
+
+type grantSpec struct {
+	Scope    []string `json:"scope"`
+	Minutes  int      `json:"minutes"`
+	Requests int      `json:"requests"`
+}
+
+func (g grantSpec) valid() bool {
+	if len(g.Scope) == 0 || g.Minutes < 0 || g.Requests < 0 || (g.Minutes == 0 && g.Requests == 0) {
+		return false
+	}
+	for _, scope := range g.Scope {
+		switch scope {
+		case "session", "tools", "rule":
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// build scopes a grant to the rule the approver reviewed, narrowed further
+// by the requested scopes, so no grant outlives the rule it was given for.
+func (g grantSpec) build(req approval.Request, now time.Time) (approval.Grant, bool) {
+	if req.RuleName == "" {
+		return approval.Grant{}, false
+	}
+	grant := approval.Grant{ApprovalID: req.ID, Rule: req.RuleName, Created: now, MaxUses: g.Requests}
+	if g.Minutes > 0 {
+		grant.Expires = now.Add(time.Duration(g.Minutes) * time.Minute)
+	}
+	for _, scope := range g.Scope {
+		switch scope {
+		case "session":
+			if req.Session == "" {
+				return approval.Grant{}, false
+			}
+			grant.Session = req.Session
+		case "tools":
+			if len(req.ToolNames) == 0 {
+				return approval.Grant{}, false
+			}
+			grant.Tools = req.ToolNames
+		}
+	}
+	return grant, true
+}
+
+func (s *Server) grant(r *http.Request, pending approval.Request, who config.Approver, comment string, spec grantSpec) {
+	grant, ok := spec.build(pending, time.Now())
+	if !ok {
+		return
+	}
+	grant.ID = newID()
+	grant.Approver = who.Name
+	grant.Roles = who.Roles
+	grant.Comment = comment
+	s.grants.Add(grant)
+	s.logEvent(audit.Event{
+		Time:          time.Now().Format(s.cfg.TimeFormat),
+		RequestID:     pending.RequestID,
+		RemoteAddr:    r.RemoteAddr,
+		Method:        pending.Method,
+		Path:          pending.Path,
+		Stage:         pending.Stage,
+		RuleName:      "approval_handler",
+		Reason:        "grant_created",
+		Upstream:      s.cfg.Upstream,
+		ApprovalID:    pending.ID,
+		GrantID:       grant.ID,
+		Approver:      who.Name,
+		ApproverRoles: who.Roles,
+		Comment:       comment,
+	})
+}
+
+func (s *Server) useGrant(r *http.Request, res policy.Result, tools []string) (policy.Result, string) {
+	if res.Decision != policy.DecisionApprove || !s.cfg.Approval.Enabled {
+		return res, ""
+	}
+	rule := s.ruleApproval(res.RuleName)
+	if rule.Quorum > 1 {
+		return res, ""
+	}
+	grant, ok := s.grants.Use(s.sessionKey(r), res.RuleName, tools, rule.Roles, time.Now())
+	if !ok {
+		return res, ""
+	}
+	res.Decision, res.Reason = policy.DecisionAllow, "approval_grant"
+	return res, grant.ID
+}
+
+// sessionKey is empty when the client sends no session header, so a
+// session-scoped grant can only be made for, and used by, a named session.
+func (s *Server) sessionKey(r *http.Request) string {
+	return r.Header.Get(s.cfg.Approval.SessionHeader)
+}
+
+func (s *Server) handleGrants(w http.ResponseWriter, r *http.Request, parts []string, who config.Approver) {
+	switch {
+	case len(parts) == 0:
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, "method_not_allowed")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"grants": s.grants.List(time.Now()),
+		})
+	case len(parts) == 1:
+		if r.Method != http.MethodDelete {
+			writeError(w, http.StatusMethodNotAllowed, "method_not_allowed")
+			return
+		}
+		grant, ok := s.grants.Revoke(parts[0])
+		if !ok {
+			writeError(w, http.StatusNotFound, "grant_not_found")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{
+			"grant_id": grant.ID,
+			"status":   "revoked",
+		})
+		s.logEvent(audit.Event{
+			Time:          time.Now().Format(s.cfg.TimeFormat),
+			RemoteAddr:    r.RemoteAddr,
+			Method:        r.Method,
+			Path:          r.URL.Path,
+			RuleName:      "approval_handler",
+			Reason:        "grant_revoked",
+			Upstream:      s.cfg.Upstream,
+			ApprovalID:    grant.ApprovalID,
+			GrantID:       grant.ID,
+			Approver:      who.Name,
+			ApproverRoles: who.Roles,
+		})
+	default:
+		writeError(w, http.StatusNotFound, "not_found")
+	}
+}
@@ -0,0 +1,46 @@
+package proxy
+
+import "sort"
+
+type sampleSegment struct {
+	Text  string `json:"text"`
+	Match bool   `json:"match,omitempty"`
+}
+
+func (s *Server) highlight(ruleName, text string) []sampleSegment {
+	if text == "" {
+		return nil
+	}
+	var spans [][]int
+	for _, re := range s.evaluator.Patterns(ruleName) {
+		for _, span := range re.FindAllStringIndex(text, -1) {
+			if span[1] > span[0] {
+				spans = append(spans, span)
+			}
+		}
+	}
+	if len(spans) == 0 {
+		return []sampleSegment{{Text: text}}
+	}
+	sort.Slice(spans, func(i, j int) bool {
+		return spans[i][0] < spans[j][0]
+	})
+	var out []sampleSegment
+	pos := 0
+	for _, span := range spans {
+		if span[1] <= pos {
+			continue
+		}
+		if span[0] > pos {
+			out = append(out, sampleSegment{Text: text[pos:span[0]]})
+		} else {
+			span[0] = pos
+		}
+		out = append(out, sampleSegment{Text: text[span[0]:span[1]], Match: true})
+		pos = span[1]
+	}
+	if pos < len(text) {
+		out = append(out, sampleSegment{Text: text[pos:]})
+	}
+	return out
+}
@@ -10,3 +10,9 @@ func newID() string {
 	_, _ = rand.Read(buf)
 	return hex.EncodeToString(buf)
 }
+
+func newToken() string {
+	buf := make([]byte, 24)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
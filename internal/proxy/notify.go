@@ -0,0 +1,54 @@
+package proxy
+
+import (
+	"strings"
+	"time"
+
+	"prompt-injection-firewall/internal/approval"
+	"prompt-injection-firewall/internal/audit"
+	"prompt-injection-firewall/internal/config"
+	"prompt-injection-firewall/internal/webhook"
+)
+
+func (s *Server) newNotifier(cfg config.Config) *webhook.Notifier {
+	if len(cfg.Approval.Webhooks) == 0 {
+		return nil
+	}
+	return webhook.New(cfg.Approval.Webhooks, func(hook config.Webhook, payload webhook.Payload, err error) {
+		s.live.Load().logEvent(audit.Event{
+			Time:        time.Now().Format(cfg.TimeFormat),
+			RequestID:   payload.RequestID,
+			RuleName:    "approval_handler",
+			Reason:      "webhook_failed",
+			Upstream:    hook.URL,
+			ApprovalID:  payload.ApprovalID,
+			ErrorString: err.Error(),
+		})
+	})
+}
+
+func (s *Server) notify(event string, req approval.Request, approver string) {
+	if s.notifier == nil {
+		return
+	}
+	base := strings.TrimRight(s.cfg.Approval.PublicURL, "/") + "/approvals/" + req.ID
+	s.notifier.Send(webhook.Payload{
+		Event:      event,
+		DeliveryID: newID(),
+		ApprovalID: req.ID,
+		RequestID:  req.RequestID,
+		Stage:      req.Stage,
+		RuleName:   req.RuleName,
+		ToolNames:  req.ToolNames,
+		TextSample: req.TextSample,
+		Status:     req.Status,
+		Approver:   approver,
+		Approvers:  req.Approvers(),
+		Comment:    req.Comment,
+		Created:    req.Created,
+		Expires:    req.Expires,
+		ApproveURL: base + "/approve",
+		RejectURL:  base + "/reject",
+		DetailURL:  base,
+	})
+}
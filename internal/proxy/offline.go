@@ -0,0 +1,90 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+
+	"prompt-injection-firewall/internal/config"
+	"prompt-injection-firewall/internal/extract"
+	"prompt-injection-firewall/internal/policy"
+)
+
+type Verdict struct {
+	Stage         string   `json:"stage"`
+	Format        string   `json:"format,omitempty"`
+	Decision      string   `json:"decision"`
+	RuleName      string   `json:"rule_name,omitempty"`
+	Reason        string   `json:"reason,omitempty"`
+	Score         float64  `json:"score,omitempty"`
+	ScoreRules    []string `json:"score_rules,omitempty"`
+	WouldDecision string   `json:"would_decision,omitempty"`
+	WouldRule     string   `json:"would_rule,omitempty"`
+	Text          string   `json:"text"`
+	ToolNames     []string `json:"tool_names,omitempty"`
+}
+
+func Evaluate(cfg config.Config, evaluator *policy.Evaluator, stage, path string, body []byte) Verdict {
+	s := &Server{cfg: cfg, evaluator: evaluator}
+	format := s.formatFor(path)
+	inspect := s.inspect
+	if stage == "response" {
+		inspect = s.inspectResponse
+	}
+	input, res := inspect(body, format)
+	return newVerdict(stage, format, input, s.shadow(res))
+}
+
+// EvaluateStream replays captured server-sent events the way relayStream
+// inspects them, returning the first verdict that would stop the stream.
+func EvaluateStream(cfg config.Config, evaluator *policy.Evaluator, path string, body []byte) Verdict {
+	s := &Server{cfg: cfg, evaluator: evaluator}
+	format := s.formatFor(path)
+	acc := extract.NewStream(cfg.Stream.WindowBytes, format)
+	acc.LimitToolArgs(int(cfg.MaxResponseBytes))
+	reader := bufio.NewReader(bytes.NewReader(body))
+	res := policy.Result{Decision: policy.DecisionAllow, Reason: "no_matching_rule"}
+	for {
+		event, data, err := readEvent(reader, int64(len(body))+1)
+		if len(event) > 0 && len(data) > 0 && !bytes.Equal(data, []byte("[DONE]")) {
+			addErr := acc.Add(data)
+			if addErr == extract.ErrToolArgsTooLarge {
+				res = policy.Result{Decision: policy.DecisionDeny, Reason: "response_too_large"}
+				break
+			}
+			res = policy.Result{Decision: policy.DecisionDeny, Reason: "invalid_stream_event"}
+			if addErr == nil {
+				res = evaluator.EvaluateResult("response", acc.Result())
+			}
+			res = s.shadow(res)
+			if res.Decision != policy.DecisionAllow {
+				break
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+	return newVerdict("response", format, acc.Result(), res)
+}
+
+func EvaluateText(cfg config.Config, evaluator *policy.Evaluator, stage, text string, toolNames []string) Verdict {
+	s := &Server{cfg: cfg, evaluator: evaluator}
+	input := extract.Result{Text: text, ToolNames: toolNames}
+	return newVerdict(stage, "", input, s.shadow(evaluator.EvaluateResult(stage, input)))
+}
+
+func newVerdict(stage string, format extract.Format, input extract.Result, res policy.Result) Verdict {
+	return Verdict{
+		Stage:         stage,
+		Format:        string(format),
+		Decision:      string(res.Decision),
+		RuleName:      res.RuleName,
+		Reason:        res.Reason,
+		Score:         res.Score,
+		ScoreRules:    res.ScoreRules(),
+		WouldDecision: string(res.WouldDecision),
+		WouldRule:     res.WouldRule,
+		Text:          input.Text,
+		ToolNames:     input.ToolNames,
+	}
+}
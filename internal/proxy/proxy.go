@@ -2,20 +2,28 @@ package proxy
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"math/rand/v2"
 	"net"
 	"net/http"
 	"net/url"
 	"strings"
-	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
+	"prompt-injection-firewall/internal/approval"
 	"prompt-injection-firewall/internal/audit"
+	"prompt-injection-firewall/internal/capture"
 	"prompt-injection-firewall/internal/config"
 	"prompt-injection-firewall/internal/extract"
 	"prompt-injection-firewall/internal/policy"
+	"prompt-injection-firewall/internal/redact"
+	"prompt-injection-firewall/internal/webhook"
 )
 
 type Server struct {
@@ -23,41 +31,98 @@ type Server struct {
 	evaluator *policy.Evaluator
 	logger    *audit.Logger
 	client    *http.Client
-	pending   *approvalStore
+	pending   approval.Store
+	waiters   *waiters
+	notifier  *webhook.Notifier
+	grants    *approval.Grants
+	secrets   *credentials
+	redactor  *redact.Redactor
+	bundle    *capture.Writer
+	vault     *capture.Vault
+	live      *atomic.Pointer[Server]
 }
 
-type approvalStore struct {
-	mu    sync.Mutex
-	items map[string]pendingRequest
-	ttl   time.Duration
+type Option func(*Server)
+
+func WithApprovalStore(store approval.Store) Option {
+	return func(s *Server) {
+		s.pending = store
+	}
 }
 
-type pendingRequest struct {
-	method  string
-	path    string
-	header  http.Header
-	body    []byte
-	created time.Time
+func WithReplayCapture(bundle *capture.Writer) Option {
+	return func(s *Server) {
+		s.bundle = bundle
+	}
 }
 
-func New(cfg config.Config, evaluator *policy.Evaluator, logger *audit.Logger) *Server {
-	return &Server{
+func WithForensicCapture(vault *capture.Vault) Option {
+	return func(s *Server) {
+		s.vault = vault
+	}
+}
+
+// New returns an error when the config names a route format or redaction
+// detector that does not exist.
+func New(cfg config.Config, evaluator *policy.Evaluator, logger *audit.Logger, opts ...Option) (*Server, error) {
+	if err := checkRoutes(cfg.Routes); err != nil {
+		return nil, err
+	}
+	redactor, err := newRedactor(cfg.Redaction)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
 		cfg:       cfg,
 		evaluator: evaluator,
 		logger:    logger,
-		client:    &http.Client{Timeout: 60 * time.Second},
-		pending: &approvalStore{
-			items: make(map[string]pendingRequest),
-			ttl:   cfg.Approval.TTL,
-		},
+		client:    &http.Client{Transport: newTransport()},
+		pending:   approval.NewMemoryStore(),
+		waiters:   newWaiters(),
+		grants:    approval.NewGrants(),
+		secrets:   newCredentials(),
+		live:      &atomic.Pointer[Server]{},
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.notifier = s.newNotifier(cfg)
+	s.redactor = redactor
+	s.live.Store(s)
+	return s, nil
+}
+
+// upstreamTimeout bounds connection setup, the wait for response headers
+// and replays of approved requests, whose replies are buffered whole.
+const upstreamTimeout = 60 * time.Second
+
+// newTransport leaves response bodies unbounded in time so long streams are
+// not cut off; forwarded requests end with the client's request context.
+func newTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second}).DialContext
+	transport.TLSHandshakeTimeout = 10 * time.Second
+	transport.ResponseHeaderTimeout = upstreamTimeout
+	return transport
 }
 
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.live.Load().serve(w, r)
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
 	if r.URL.Path == "/approve" {
 		s.handleApprove(w, r)
 		return
 	}
+	if r.URL.Path == "/approvals" || strings.HasPrefix(r.URL.Path, "/approvals/") {
+		s.handleApprovals(w, r)
+		return
+	}
+	if s.isUIPath(r.URL.Path) {
+		s.handleUI(w, r)
+		return
+	}
 	start := time.Now()
 	requestID := newID()
 	body, err := readBody(r, s.cfg.MaxBodyBytes)
@@ -78,24 +143,33 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
-	text, toolNames, decision, ruleName, reason := s.inspect(body)
+	input, res := s.inspect(body, s.formatFor(r.URL.Path))
+	s.captureReplay(requestID, "request", r.URL.Path, body, false)
+	res = s.shadow(res)
+	res, grantID := s.useGrant(r, res, input.ToolNames)
+	text, toolNames, decision, ruleName, reason := input.Text, input.ToolNames, res.Decision, res.RuleName, res.Reason
 	if decision == policy.DecisionDeny {
 		writeError(w, http.StatusForbidden, "blocked")
 		s.logEvent(audit.Event{
-			Time:       time.Now().Format(s.cfg.TimeFormat),
-			RequestID:  requestID,
-			RemoteAddr: r.RemoteAddr,
-			Method:     r.Method,
-			Path:       r.URL.Path,
-			Decision:   string(decision),
-			RuleName:   ruleName,
-			Reason:     reason,
-			TextSample: sample(text),
-			ToolNames:  toolNames,
-			Upstream:   s.cfg.Upstream,
-			ElapsedMS:  elapsedMS(start),
-			BytesIn:    len(body),
-			StatusCode: http.StatusForbidden,
+			Time:          time.Now().Format(s.cfg.TimeFormat),
+			RequestID:     requestID,
+			RemoteAddr:    r.RemoteAddr,
+			Method:        r.Method,
+			Path:          r.URL.Path,
+			Decision:      string(decision),
+			RuleName:      ruleName,
+			Score:         res.Score,
+			ScoreRules:    res.ScoreRules(),
+			WouldDecision: string(res.WouldDecision),
+			WouldRule:     res.WouldRule,
+			Reason:        reason,
+			TextSample:    s.sample(text),
+			ToolNames:     toolNames,
+			Upstream:      s.cfg.Upstream,
+			ElapsedMS:     elapsedMS(start),
+			BytesIn:       len(body),
+			CaptureID:     s.captureForensic(r, requestID, "request", decision, ruleName, body, nil),
+			StatusCode:    http.StatusForbidden,
 		})
 		return
 	}
@@ -103,105 +177,402 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		if !s.cfg.Approval.Enabled {
 			writeError(w, http.StatusForbidden, "approval_disabled")
 			s.logEvent(audit.Event{
-				Time:       time.Now().Format(s.cfg.TimeFormat),
-				RequestID:  requestID,
-				RemoteAddr: r.RemoteAddr,
-				Method:     r.Method,
-				Path:       r.URL.Path,
-				Decision:   string(policy.DecisionDeny),
-				RuleName:   ruleName,
-				Reason:     "approval_disabled",
-				TextSample: sample(text),
-				ToolNames:  toolNames,
-				Upstream:   s.cfg.Upstream,
-				ElapsedMS:  elapsedMS(start),
-				BytesIn:    len(body),
-				StatusCode: http.StatusForbidden,
+				Time:          time.Now().Format(s.cfg.TimeFormat),
+				RequestID:     requestID,
+				RemoteAddr:    r.RemoteAddr,
+				Method:        r.Method,
+				Path:          r.URL.Path,
+				Decision:      string(policy.DecisionDeny),
+				RuleName:      ruleName,
+				Score:         res.Score,
+				ScoreRules:    res.ScoreRules(),
+				WouldDecision: string(res.WouldDecision),
+				WouldRule:     res.WouldRule,
+				Reason:        "approval_disabled",
+				TextSample:    s.sample(text),
+				ToolNames:     toolNames,
+				Upstream:      s.cfg.Upstream,
+				ElapsedMS:     elapsedMS(start),
+				BytesIn:       len(body),
+				CaptureID:     s.captureForensic(r, requestID, "request", decision, ruleName, body, nil),
+				StatusCode:    http.StatusForbidden,
 			})
 			return
 		}
-		approvalID := s.pending.store(pendingRequest{
-			method:  r.Method,
-			path:    r.URL.RequestURI(),
-			header:  cloneHeader(r.Header),
-			body:    body,
-			created: time.Now(),
-		})
-		writeJSON(w, http.StatusAccepted, map[string]string{
-			"approval_id": approvalID,
-			"status":      "approval_required",
-		})
-		s.logEvent(audit.Event{
-			Time:       time.Now().Format(s.cfg.TimeFormat),
+		captureID := s.captureForensic(r, requestID, "request", decision, ruleName, body, nil)
+		approvalID, resultToken, err := s.hold(approval.Request{
 			RequestID:  requestID,
-			RemoteAddr: r.RemoteAddr,
-			Method:     r.Method,
-			Path:       r.URL.Path,
-			Decision:   string(decision),
+			Stage:      "request",
 			RuleName:   ruleName,
 			Reason:     reason,
-			TextSample: sample(text),
 			ToolNames:  toolNames,
-			Upstream:   s.cfg.Upstream,
-			ApprovalID: approvalID,
-			ElapsedMS:  elapsedMS(start),
-			BytesIn:    len(body),
-			StatusCode: http.StatusAccepted,
+			TextSample: s.sample(text),
+			Session:    s.sessionKey(r),
+			Method:     r.Method,
+			Path:       r.URL.RequestURI(),
+			Header:     cloneHeader(r.Header),
+			Body:       body,
+			CaptureID:  captureID,
+		})
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "approval_store_error")
+			s.logEvent(audit.Event{
+				Time:        time.Now().Format(s.cfg.TimeFormat),
+				RequestID:   requestID,
+				RemoteAddr:  r.RemoteAddr,
+				Method:      r.Method,
+				Path:        r.URL.Path,
+				Decision:    string(policy.DecisionDeny),
+				RuleName:    ruleName,
+				Reason:      "approval_store_error",
+				TextSample:  s.sample(text),
+				ToolNames:   toolNames,
+				Upstream:    s.cfg.Upstream,
+				ElapsedMS:   elapsedMS(start),
+				BytesIn:     len(body),
+				StatusCode:  http.StatusInternalServerError,
+				ErrorString: err.Error(),
+			})
+			return
+		}
+		s.logEvent(audit.Event{
+			Time:          time.Now().Format(s.cfg.TimeFormat),
+			RequestID:     requestID,
+			RemoteAddr:    r.RemoteAddr,
+			Method:        r.Method,
+			Path:          r.URL.Path,
+			Decision:      string(decision),
+			RuleName:      ruleName,
+			Score:         res.Score,
+			ScoreRules:    res.ScoreRules(),
+			WouldDecision: string(res.WouldDecision),
+			WouldRule:     res.WouldRule,
+			Reason:        reason,
+			TextSample:    s.sample(text),
+			ToolNames:     toolNames,
+			Upstream:      s.cfg.Upstream,
+			ApprovalID:    approvalID,
+			ElapsedMS:     elapsedMS(start),
+			BytesIn:       len(body),
+			CaptureID:     captureID,
+			StatusCode:    http.StatusAccepted,
 		})
+		s.respondPending(w, r, approvalID, resultToken)
 		return
 	}
 	resp, err := s.forward(r, body, requestID)
 	if err != nil {
 		writeError(w, http.StatusBadGateway, "upstream_error")
+		s.logEvent(audit.Event{
+			Time:          time.Now().Format(s.cfg.TimeFormat),
+			RequestID:     requestID,
+			RemoteAddr:    r.RemoteAddr,
+			Method:        r.Method,
+			Path:          r.URL.Path,
+			Decision:      string(decision),
+			RuleName:      ruleName,
+			Score:         res.Score,
+			ScoreRules:    res.ScoreRules(),
+			WouldDecision: string(res.WouldDecision),
+			WouldRule:     res.WouldRule,
+			Reason:        err.Error(),
+			TextSample:    s.sample(text),
+			ToolNames:     toolNames,
+			Upstream:      s.cfg.Upstream,
+			GrantID:       grantID,
+			ElapsedMS:     elapsedMS(start),
+			BytesIn:       len(body),
+			StatusCode:    http.StatusBadGateway,
+			ErrorString:   err.Error(),
+		})
+		return
+	}
+	defer resp.Body.Close()
+	if s.evaluator.HasStage("response") {
+		s.relayInspected(w, r, resp, requestID, start, body, ruleName, reason, grantID)
+		return
+	}
+	copyHeaders(w.Header(), resp.Header)
+	w.WriteHeader(resp.StatusCode)
+	var tee *boundedBuffer
+	var out io.Writer = w
+	if s.vault != nil {
+		tee = &boundedBuffer{limit: s.cfg.MaxResponseBytes}
+		out = io.MultiWriter(w, tee)
+	}
+	bytesOut, _ := io.Copy(out, resp.Body)
+	var captureID string
+	if tee != nil {
+		captureID = s.captureForensic(r, requestID, "request", decision, ruleName, body, &approval.Response{Status: resp.StatusCode, Header: resp.Header, Body: tee.data})
+	}
+	s.logEvent(audit.Event{
+		Time:          time.Now().Format(s.cfg.TimeFormat),
+		RequestID:     requestID,
+		RemoteAddr:    r.RemoteAddr,
+		Method:        r.Method,
+		Path:          r.URL.Path,
+		Decision:      string(decision),
+		RuleName:      ruleName,
+		Score:         res.Score,
+		ScoreRules:    res.ScoreRules(),
+		WouldDecision: string(res.WouldDecision),
+		WouldRule:     res.WouldRule,
+		Reason:        reason,
+		TextSample:    s.sample(text),
+		ToolNames:     toolNames,
+		Upstream:      s.cfg.Upstream,
+		GrantID:       grantID,
+		ElapsedMS:     elapsedMS(start),
+		BytesIn:       len(body),
+		BytesOut:      int(bytesOut),
+		CaptureID:     captureID,
+		StatusCode:    resp.StatusCode,
+	})
+}
+
+func (s *Server) relayInspected(w http.ResponseWriter, r *http.Request, resp *http.Response, requestID string, start time.Time, body []byte, requestRule, requestReason, grantID string) {
+	if isEventStream(resp.Header) {
+		s.relayStream(w, r, resp, requestID, start, body, requestRule, requestReason, grantID)
+		return
+	}
+	respBody, err := readLimited(resp.Body, s.cfg.MaxResponseBytes)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, "response_too_large")
 		s.logEvent(audit.Event{
 			Time:        time.Now().Format(s.cfg.TimeFormat),
 			RequestID:   requestID,
 			RemoteAddr:  r.RemoteAddr,
 			Method:      r.Method,
 			Path:        r.URL.Path,
-			Decision:    string(decision),
-			RuleName:    ruleName,
-			Reason:      err.Error(),
-			TextSample:  sample(text),
-			ToolNames:   toolNames,
+			Stage:       "response",
+			Decision:    string(policy.DecisionDeny),
+			Reason:      "response_too_large",
 			Upstream:    s.cfg.Upstream,
 			ElapsedMS:   elapsedMS(start),
 			BytesIn:     len(body),
+			BytesOut:    len(respBody),
 			StatusCode:  http.StatusBadGateway,
 			ErrorString: err.Error(),
 		})
 		return
 	}
-	defer resp.Body.Close()
-	copyHeaders(w.Header(), resp.Header)
-	w.WriteHeader(resp.StatusCode)
-	bytesOut, _ := io.Copy(w, resp.Body)
+	upstream := &approval.Response{Status: resp.StatusCode, Header: resp.Header, Body: respBody}
+	output, res := s.inspectResponse(respBody, s.formatFor(r.URL.Path))
+	s.captureReplay(requestID, "response", r.URL.Path, respBody, false)
+	res = s.shadow(res)
+	res, responseGrant := s.useGrant(r, res, output.ToolNames)
+	if responseGrant != "" {
+		grantID = responseGrant
+	}
+	text, toolNames, decision, ruleName, reason := output.Text, output.ToolNames, res.Decision, res.RuleName, res.Reason
+	if decision == policy.DecisionDeny {
+		writeError(w, http.StatusForbidden, "response_blocked")
+		s.logEvent(audit.Event{
+			Time:          time.Now().Format(s.cfg.TimeFormat),
+			RequestID:     requestID,
+			RemoteAddr:    r.RemoteAddr,
+			Method:        r.Method,
+			Path:          r.URL.Path,
+			Stage:         "response",
+			Decision:      string(decision),
+			RuleName:      ruleName,
+			Score:         res.Score,
+			ScoreRules:    res.ScoreRules(),
+			WouldDecision: string(res.WouldDecision),
+			WouldRule:     res.WouldRule,
+			Reason:        reason,
+			TextSample:    s.sample(text),
+			ToolNames:     toolNames,
+			Upstream:      s.cfg.Upstream,
+			GrantID:       grantID,
+			ElapsedMS:     elapsedMS(start),
+			BytesIn:       len(body),
+			BytesOut:      len(respBody),
+			CaptureID:     s.captureForensic(r, requestID, "response", decision, ruleName, body, upstream),
+			StatusCode:    http.StatusForbidden,
+		})
+		return
+	}
+	if decision == policy.DecisionApprove {
+		if !s.cfg.Approval.Enabled {
+			writeError(w, http.StatusForbidden, "approval_disabled")
+			s.logEvent(audit.Event{
+				Time:          time.Now().Format(s.cfg.TimeFormat),
+				RequestID:     requestID,
+				RemoteAddr:    r.RemoteAddr,
+				Method:        r.Method,
+				Path:          r.URL.Path,
+				Stage:         "response",
+				Decision:      string(policy.DecisionDeny),
+				RuleName:      ruleName,
+				Score:         res.Score,
+				ScoreRules:    res.ScoreRules(),
+				WouldDecision: string(res.WouldDecision),
+				WouldRule:     res.WouldRule,
+				Reason:        "approval_disabled",
+				TextSample:    s.sample(text),
+				ToolNames:     toolNames,
+				Upstream:      s.cfg.Upstream,
+				GrantID:       grantID,
+				ElapsedMS:     elapsedMS(start),
+				BytesIn:       len(body),
+				BytesOut:      len(respBody),
+				CaptureID:     s.captureForensic(r, requestID, "response", decision, ruleName, body, upstream),
+				StatusCode:    http.StatusForbidden,
+			})
+			return
+		}
+		captureID := s.captureForensic(r, requestID, "response", decision, ruleName, body, upstream)
+		approvalID, resultToken, err := s.hold(approval.Request{
+			RequestID:  requestID,
+			Stage:      "response",
+			RuleName:   ruleName,
+			Reason:     reason,
+			ToolNames:  toolNames,
+			TextSample: s.sample(text),
+			Session:    s.sessionKey(r),
+			Method:     r.Method,
+			Path:       r.URL.RequestURI(),
+			Header:     cloneHeader(r.Header),
+			Body:       body,
+			Response: &approval.Response{
+				Status: resp.StatusCode,
+				Header: cloneHeader(resp.Header),
+				Body:   respBody,
+			},
+			CaptureID: captureID,
+		})
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "approval_store_error")
+			s.logEvent(audit.Event{
+				Time:        time.Now().Format(s.cfg.TimeFormat),
+				RequestID:   requestID,
+				RemoteAddr:  r.RemoteAddr,
+				Method:      r.Method,
+				Path:        r.URL.Path,
+				Stage:       "response",
+				Decision:    string(policy.DecisionDeny),
+				RuleName:    ruleName,
+				Reason:      "approval_store_error",
+				TextSample:  s.sample(text),
+				ToolNames:   toolNames,
+				Upstream:    s.cfg.Upstream,
+				ElapsedMS:   elapsedMS(start),
+				BytesIn:     len(body),
+				BytesOut:    len(respBody),
+				StatusCode:  http.StatusInternalServerError,
+				ErrorString: err.Error(),
+			})
+			return
+		}
+		s.logEvent(audit.Event{
+			Time:          time.Now().Format(s.cfg.TimeFormat),
+			RequestID:     requestID,
+			RemoteAddr:    r.RemoteAddr,
+			Method:        r.Method,
+			Path:          r.URL.Path,
+			Stage:         "response",
+			Decision:      string(decision),
+			RuleName:      ruleName,
+			Score:         res.Score,
+			ScoreRules:    res.ScoreRules(),
+			WouldDecision: string(res.WouldDecision),
+			WouldRule:     res.WouldRule,
+			Reason:        reason,
+			TextSample:    s.sample(text),
+			ToolNames:     toolNames,
+			Upstream:      s.cfg.Upstream,
+			GrantID:       grantID,
+			ApprovalID:    approvalID,
+			ElapsedMS:     elapsedMS(start),
+			BytesIn:       len(body),
+			BytesOut:      len(respBody),
+			CaptureID:     captureID,
+			StatusCode:    http.StatusAccepted,
+		})
+		s.respondPending(w, r, approvalID, resultToken)
+		return
+	}
+	if ruleName == "" {
+		ruleName, reason = requestRule, requestReason
+	}
+	writeHeld(w, *upstream)
 	s.logEvent(audit.Event{
-		Time:       time.Now().Format(s.cfg.TimeFormat),
-		RequestID:  requestID,
-		RemoteAddr: r.RemoteAddr,
-		Method:     r.Method,
-		Path:       r.URL.Path,
-		Decision:   string(decision),
-		RuleName:   ruleName,
-		Reason:     reason,
-		TextSample: sample(text),
-		ToolNames:  toolNames,
-		Upstream:   s.cfg.Upstream,
-		ElapsedMS:  elapsedMS(start),
-		BytesIn:    len(body),
-		BytesOut:   int(bytesOut),
-		StatusCode: resp.StatusCode,
+		Time:          time.Now().Format(s.cfg.TimeFormat),
+		RequestID:     requestID,
+		RemoteAddr:    r.RemoteAddr,
+		Method:        r.Method,
+		Path:          r.URL.Path,
+		Stage:         "response",
+		Decision:      string(decision),
+		RuleName:      ruleName,
+		Score:         res.Score,
+		ScoreRules:    res.ScoreRules(),
+		WouldDecision: string(res.WouldDecision),
+		WouldRule:     res.WouldRule,
+		Reason:        reason,
+		TextSample:    s.sample(text),
+		ToolNames:     toolNames,
+		Upstream:      s.cfg.Upstream,
+		GrantID:       grantID,
+		ElapsedMS:     elapsedMS(start),
+		BytesIn:       len(body),
+		BytesOut:      len(respBody),
+		CaptureID:     s.captureForensic(r, requestID, "response", decision, ruleName, body, upstream),
+		StatusCode:    resp.StatusCode,
 	})
 }
 
-func (s *Server) inspect(body []byte) (string, []string, policy.Decision, string, string) {
-	result, err := extract.FromJSON(body)
+func checkRoutes(routes []config.Route) error {
+	for _, route := range routes {
+		if _, err := extract.ParseFormat(route.Format); err != nil {
+			return fmt.Errorf("route %s: %w", route.PathPrefix, err)
+		}
+	}
+	return nil
+}
+
+func (s *Server) formatFor(path string) extract.Format {
+	format := extract.FormatAuto
+	longest := -1
+	for _, route := range s.cfg.Routes {
+		if strings.HasPrefix(path, route.PathPrefix) && len(route.PathPrefix) > longest {
+			parsed, err := extract.ParseFormat(route.Format)
+			if err != nil {
+				continue
+			}
+			format = parsed
+			longest = len(route.PathPrefix)
+		}
+	}
+	return format
+}
+
+func (s *Server) inspect(body []byte, format extract.Format) (extract.Result, policy.Result) {
+	result, err := extract.FromJSONFormat(body, format)
 	if err != nil {
-		return "", nil, policy.DecisionDeny, "", "invalid_json"
+		return extract.Result{}, policy.Result{Decision: policy.DecisionDeny, Reason: "invalid_json"}
 	}
-	res := s.evaluator.Evaluate("request", result.Text, result.ToolNames)
-	return result.Text, result.ToolNames, res.Decision, res.RuleName, res.Reason
+	return result, s.evaluator.EvaluateResult("request", result)
+}
+
+func (s *Server) inspectResponse(body []byte, format extract.Format) (extract.Result, policy.Result) {
+	result, err := extract.FromResponseJSONFormat(body, format)
+	if err != nil {
+		result = extract.Result{Text: string(body)}
+	}
+	return result, s.evaluator.EvaluateResult("response", result)
+}
+
+func (s *Server) shadow(res policy.Result) policy.Result {
+	if !s.cfg.DryRun || res.Decision == policy.DecisionAllow {
+		return res
+	}
+	if res.WouldDecision == "" {
+		res.WouldDecision, res.WouldRule = res.Decision, res.RuleName
+	}
+	res.Decision, res.RuleName, res.Reason = policy.DecisionAllow, "", "dry_run"
+	return res
 }
 
 func (s *Server) forward(r *http.Request, body []byte, requestID string) (*http.Response, error) {
@@ -212,12 +583,15 @@ func (s *Server) forward(r *http.Request, body []byte, requestID string) (*http.
 	target := *upstreamURL
 	target.Path = joinPaths(upstreamURL.Path, r.URL.Path)
 	target.RawQuery = r.URL.RawQuery
-	req, err := http.NewRequest(r.Method, target.String(), bytes.NewReader(body))
+	req, err := http.NewRequestWithContext(r.Context(), r.Method, target.String(), bytes.NewReader(body))
 	if err != nil {
 		return nil, err
 	}
 	copyHeaders(req.Header, r.Header)
 	removeHopHeaders(req.Header)
+	if s.evaluator.HasStage("response") {
+		req.Header.Del("Accept-Encoding")
+	}
 	if s.cfg.Headers.AddRequestIDHeader {
 		req.Header.Set("X-Request-ID", requestID)
 	}
@@ -226,117 +600,376 @@ func (s *Server) forward(r *http.Request, body []byte, requestID string) (*http.
 }
 
 func (s *Server) handleApprove(w http.ResponseWriter, r *http.Request) {
-	if !s.cfg.Approval.Enabled {
-		writeError(w, http.StatusNotFound, "approval_disabled")
+	who, ok := s.authorizeApproval(w, r)
+	if !ok {
 		return
 	}
 	if r.Method != http.MethodPost {
 		writeError(w, http.StatusMethodNotAllowed, "method_not_allowed")
 		return
 	}
-	if s.cfg.Approval.Token != "" {
-		if r.Header.Get("X-Approval-Token") != s.cfg.Approval.Token {
-			writeError(w, http.StatusUnauthorized, "invalid_token")
-			return
-		}
-	}
 	body, err := readBody(r, 1024*16)
 	if err != nil {
 		writeError(w, http.StatusBadRequest, "invalid_body")
 		return
 	}
 	var payload struct {
-		ApprovalID string `json:"approval_id"`
+		ApprovalID string     `json:"approval_id"`
+		Comment    string     `json:"comment"`
+		Grant      *grantSpec `json:"grant"`
 	}
 	if err := json.Unmarshal(body, &payload); err != nil || payload.ApprovalID == "" {
 		writeError(w, http.StatusBadRequest, "invalid_approval_id")
 		return
 	}
-	pending, ok := s.pending.fetch(payload.ApprovalID)
+	s.approve(w, r, payload.ApprovalID, who, payload.Comment, payload.Grant)
+}
+
+func (s *Server) approve(w http.ResponseWriter, r *http.Request, id string, who config.Approver, comment string, spec *grantSpec) {
+	if spec != nil && !spec.valid() {
+		writeError(w, http.StatusBadRequest, "invalid_grant")
+		return
+	}
+	pending, ok := s.vote(w, id, who, comment, spec)
 	if !ok {
-		writeError(w, http.StatusNotFound, "approval_not_found")
 		return
 	}
+	if pending.Status == approval.StatusPending {
+		writeJSON(w, http.StatusAccepted, map[string]interface{}{
+			"approval_id": id,
+			"status":      approval.StatusPending,
+			"approvals":   len(pending.Votes),
+			"quorum":      pending.Quorum,
+		})
+		s.logEvent(audit.Event{
+			Time:          time.Now().Format(s.cfg.TimeFormat),
+			RequestID:     pending.RequestID,
+			RemoteAddr:    r.RemoteAddr,
+			Method:        pending.Method,
+			Path:          pending.Path,
+			Stage:         pending.Stage,
+			RuleName:      "approval_handler",
+			Reason:        "approval_recorded",
+			Upstream:      s.cfg.Upstream,
+			ApprovalID:    id,
+			Approver:      who.Name,
+			ApproverRoles: who.Roles,
+			Approvers:     pending.Approvers(),
+			Comment:       comment,
+			StatusCode:    http.StatusAccepted,
+		})
+		return
+	}
+	s.notify(webhook.EventApproved, pending, who.Name)
+	if spec != nil {
+		s.grant(r, pending, who, comment, *spec)
+	}
+	writeHeld(w, s.release(r.RemoteAddr, id, pending, who, comment))
+}
+
+// release sends an approved request upstream, or hands over its held
+// reply, and stores the outcome as the approval's result.
+func (s *Server) release(remoteAddr, id string, pending approval.Request, who config.Approver, comment string) approval.Response {
 	start := time.Now()
-	req, err := http.NewRequest(pending.method, s.cfg.Upstream+pending.path, bytes.NewReader(pending.body))
+	if pending.Response != nil {
+		s.resolve(id, *pending.Response)
+		s.logEvent(audit.Event{
+			Time:          time.Now().Format(s.cfg.TimeFormat),
+			RequestID:     pending.RequestID,
+			RemoteAddr:    remoteAddr,
+			Method:        pending.Method,
+			Path:          pending.Path,
+			Stage:         "response",
+			Decision:      string(policy.DecisionApprove),
+			RuleName:      "approval_handler",
+			Reason:        "approved_response",
+			Upstream:      s.cfg.Upstream,
+			ApprovalID:    id,
+			Approver:      who.Name,
+			ApproverRoles: who.Roles,
+			Approvers:     pending.Approvers(),
+			Comment:       comment,
+			ElapsedMS:     elapsedMS(start),
+			BytesOut:      len(pending.Response.Body),
+			StatusCode:    pending.Response.Status,
+		})
+		return *pending.Response
+	}
+	result, err := s.replay(pending)
 	if err != nil {
-		writeError(w, http.StatusBadGateway, "upstream_error")
-		return
+		result = errorResponse(http.StatusBadGateway, "upstream_error")
+		s.resolve(id, result)
+		s.logEvent(audit.Event{
+			Time:          time.Now().Format(s.cfg.TimeFormat),
+			RequestID:     pending.RequestID,
+			RemoteAddr:    remoteAddr,
+			Method:        pending.Method,
+			Path:          pending.Path,
+			Decision:      string(policy.DecisionApprove),
+			RuleName:      "approval_handler",
+			Reason:        err.Error(),
+			Upstream:      s.cfg.Upstream,
+			ApprovalID:    id,
+			Approver:      who.Name,
+			ApproverRoles: who.Roles,
+			Approvers:     pending.Approvers(),
+			Comment:       comment,
+			ElapsedMS:     elapsedMS(start),
+			StatusCode:    http.StatusBadGateway,
+			ErrorString:   err.Error(),
+		})
+		return result
+	}
+	s.captureApproved(pending, result)
+	result = s.inspectApproved(remoteAddr, id, pending, result, start)
+	s.resolve(id, result)
+	s.logEvent(audit.Event{
+		Time:          time.Now().Format(s.cfg.TimeFormat),
+		RequestID:     pending.RequestID,
+		RemoteAddr:    remoteAddr,
+		Method:        pending.Method,
+		Path:          pending.Path,
+		Decision:      string(policy.DecisionApprove),
+		RuleName:      "approval_handler",
+		Reason:        "approved_request",
+		Upstream:      s.cfg.Upstream,
+		ApprovalID:    id,
+		Approver:      who.Name,
+		ApproverRoles: who.Roles,
+		Approvers:     pending.Approvers(),
+		Comment:       comment,
+		ElapsedMS:     elapsedMS(start),
+		BytesOut:      len(result.Body),
+		StatusCode:    result.Status,
+	})
+	return result
+}
+
+func (s *Server) replay(pending approval.Request) (approval.Response, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), upstreamTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, pending.Method, s.cfg.Upstream+pending.Path, bytes.NewReader(pending.Body))
+	if err != nil {
+		return approval.Response{}, err
 	}
-	copyHeaders(req.Header, pending.header)
+	copyHeaders(req.Header, pending.Header)
+	copyHeaders(req.Header, s.secrets.get(pending.ID))
 	removeHopHeaders(req.Header)
 	resp, err := s.client.Do(req)
 	if err != nil {
-		writeError(w, http.StatusBadGateway, "upstream_error")
-		s.logEvent(audit.Event{
-			Time:        time.Now().Format(s.cfg.TimeFormat),
-			Decision:    string(policy.DecisionApprove),
-			RuleName:    "approval_handler",
-			Reason:      err.Error(),
-			Upstream:    s.cfg.Upstream,
-			ApprovalID:  payload.ApprovalID,
-			ElapsedMS:   elapsedMS(start),
-			StatusCode:  http.StatusBadGateway,
-			ErrorString: err.Error(),
+		return approval.Response{}, err
+	}
+	defer resp.Body.Close()
+	limit := s.cfg.MaxResponseBytes
+	if limit <= 0 {
+		limit = 4 * 1024 * 1024
+	}
+	body, err := readLimited(resp.Body, limit)
+	if err != nil {
+		return approval.Response{}, err
+	}
+	header := cloneHeader(resp.Header)
+	removeHopHeaders(header)
+	return approval.Response{Status: resp.StatusCode, Header: header, Body: body}, nil
+}
+
+// inspectApproved runs response rules over the reply to an approved
+// request, which skipped relayInspected when it was held.
+func (s *Server) inspectApproved(remoteAddr, id string, pending approval.Request, result approval.Response, start time.Time) approval.Response {
+	if !s.evaluator.HasStage("response") {
+		return result
+	}
+	path := pending.Path
+	if parsed, err := url.ParseRequestURI(path); err == nil {
+		path = parsed.Path
+	}
+	output, res := s.inspectResponse(result.Body, s.formatFor(path))
+	res = s.shadow(res)
+	event := audit.Event{
+		Time:          time.Now().Format(s.cfg.TimeFormat),
+		RequestID:     pending.RequestID,
+		RemoteAddr:    remoteAddr,
+		Method:        pending.Method,
+		Path:          pending.Path,
+		Stage:         "response",
+		Decision:      string(res.Decision),
+		RuleName:      res.RuleName,
+		Score:         res.Score,
+		ScoreRules:    res.ScoreRules(),
+		WouldDecision: string(res.WouldDecision),
+		WouldRule:     res.WouldRule,
+		Reason:        res.Reason,
+		TextSample:    s.sample(output.Text),
+		ToolNames:     output.ToolNames,
+		Upstream:      s.cfg.Upstream,
+		ApprovalID:    id,
+		ElapsedMS:     elapsedMS(start),
+		BytesIn:       len(pending.Body),
+		BytesOut:      len(result.Body),
+		StatusCode:    result.Status,
+	}
+	switch res.Decision {
+	case policy.DecisionDeny:
+		result = errorResponse(http.StatusForbidden, "response_blocked")
+	case policy.DecisionApprove:
+		approvalID, resultToken, err := s.hold(approval.Request{
+			RequestID:  pending.RequestID,
+			Stage:      "response",
+			RuleName:   res.RuleName,
+			Reason:     res.Reason,
+			ToolNames:  output.ToolNames,
+			TextSample: s.sample(output.Text),
+			Session:    pending.Session,
+			Method:     pending.Method,
+			Path:       pending.Path,
+			Header:     pending.Header,
+			Body:       pending.Body,
+			Response:   &result,
+			CaptureID:  pending.CaptureID,
 		})
+		if err != nil {
+			event.Decision, event.Reason, event.ErrorString = string(policy.DecisionDeny), "approval_store_error", err.Error()
+			result = errorResponse(http.StatusInternalServerError, "approval_store_error")
+			break
+		}
+		event.ApprovalID = approvalID
+		data, _ := json.Marshal(pendingBody(approvalID, resultToken))
+		result = approval.Response{Status: http.StatusAccepted, Header: http.Header{"Content-Type": {"application/json"}}, Body: data}
+	}
+	event.StatusCode = result.Status
+	s.logEvent(event)
+	return result
+}
+
+func (s *Server) captureReplay(requestID, stage, path string, body []byte, stream bool) {
+	if s.bundle == nil {
 		return
 	}
-	defer resp.Body.Close()
-	copyHeaders(w.Header(), resp.Header)
-	w.WriteHeader(resp.StatusCode)
-	_, _ = io.Copy(w, resp.Body)
-	s.logEvent(audit.Event{
-		Time:       time.Now().Format(s.cfg.TimeFormat),
-		Decision:   string(policy.DecisionApprove),
-		RuleName:   "approval_handler",
-		Reason:     "approved_request",
-		Upstream:   s.cfg.Upstream,
-		ApprovalID: payload.ApprovalID,
-		ElapsedMS:  elapsedMS(start),
-		StatusCode: resp.StatusCode,
+	_ = s.bundle.Write(capture.Record{RequestID: requestID, Time: time.Now(), Stage: stage, Path: path, Stream: stream, Body: body})
+}
+
+// captureForensic seals the full exchange when the decision is selected
+// for capture and returns the id to reference from the audit event.
+func (s *Server) captureForensic(r *http.Request, requestID, stage string, decision policy.Decision, ruleName string, body []byte, resp *approval.Response) string {
+	if s.vault == nil || !s.captureSelected(decision) {
+		return ""
+	}
+	f := capture.Forensic{
+		ID:       requestID,
+		Time:     time.Now(),
+		Stage:    stage,
+		Decision: string(decision),
+		RuleName: ruleName,
+		Method:   r.Method,
+		Path:     r.URL.RequestURI(),
+		Request:  capture.Exchange{Header: redactHeader(r.Header), Body: body},
+	}
+	if resp != nil {
+		f.Response = &capture.Exchange{Status: resp.Status, Header: redactHeader(resp.Header), Body: resp.Body}
+	}
+	if err := s.vault.Save(f); err != nil {
+		return ""
+	}
+	return f.ID
+}
+
+// captureApproved reseals the capture taken when a request was held, now
+// with the upstream reply, under the id the hold event already references.
+func (s *Server) captureApproved(pending approval.Request, result approval.Response) {
+	if s.vault == nil || pending.CaptureID == "" {
+		return
+	}
+	_ = s.vault.Save(capture.Forensic{
+		ID:       pending.CaptureID,
+		Time:     pending.Created,
+		Stage:    pending.Stage,
+		Decision: string(policy.DecisionApprove),
+		RuleName: pending.RuleName,
+		Method:   pending.Method,
+		Path:     pending.Path,
+		Request:  capture.Exchange{Header: redactHeader(pending.Header), Body: pending.Body},
+		Response: &capture.Exchange{Status: result.Status, Header: redactHeader(result.Header), Body: result.Body},
 	})
 }
 
+func (s *Server) captureSelected(decision policy.Decision) bool {
+	for _, selected := range s.cfg.Capture.Decisions {
+		if selected == string(decision) {
+			return true
+		}
+	}
+	return s.cfg.Capture.SampleRate > 0 && rand.Float64() < s.cfg.Capture.SampleRate
+}
+
 func (s *Server) logEvent(event audit.Event) {
 	if s.logger == nil {
 		return
 	}
+	if event.PolicyVersion == "" {
+		event.PolicyVersion = s.cfg.Version
+	}
 	_ = s.logger.Write(event)
 }
 
-func (s *approvalStore) store(req pendingRequest) string {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.cleanupLocked()
-	id := newID()
-	s.items[id] = req
-	return id
+func (s *Server) ruleApproval(name string) config.RuleApproval {
+	for _, rule := range s.cfg.Rules {
+		if rule.Name == name {
+			return rule.Approval
+		}
+	}
+	return config.RuleApproval{}
 }
 
-func (s *approvalStore) fetch(id string) (pendingRequest, bool) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	req, ok := s.items[id]
-	if !ok {
-		return pendingRequest{}, false
+func (s *Server) respondPending(w http.ResponseWriter, r *http.Request, approvalID, resultToken string) {
+	if !s.cfg.Approval.HoldConnection {
+		writeJSON(w, http.StatusAccepted, pendingBody(approvalID, resultToken))
+		return
+	}
+	req, ok, err := s.awaitOutcome(r.Context(), approvalID, s.cfg.Approval.TTL)
+	if r.Context().Err() != nil {
+		return
+	}
+	if !s.pendingFound(w, ok, err) {
+		return
 	}
-	if time.Since(req.created) > s.ttl {
-		delete(s.items, id)
-		return pendingRequest{}, false
+	if !req.Resolved() {
+		writeJSON(w, http.StatusAccepted, pendingBody(approvalID, resultToken))
+		return
 	}
-	delete(s.items, id)
-	return req, true
+	writeOutcome(w, req)
 }
 
-func (s *approvalStore) cleanupLocked() {
-	if len(s.items) == 0 {
-		return
+func pendingBody(approvalID, resultToken string) map[string]string {
+	return map[string]string{
+		"approval_id":  approvalID,
+		"status":       "approval_required",
+		"result_token": resultToken,
 	}
-	for id, req := range s.items {
-		if time.Since(req.created) > s.ttl {
-			delete(s.items, id)
-		}
+}
+
+func (s *Server) hold(req approval.Request) (string, string, error) {
+	rule := s.ruleApproval(req.RuleName)
+	req.Quorum, req.Roles = rule.Quorum, rule.Roles
+	if req.Quorum < 1 {
+		req.Quorum = 1
+	}
+	req.ID = newID()
+	req.Status = approval.StatusPending
+	req.Created = time.Now()
+	req.Expires = req.Created.Add(s.cfg.Approval.TTL)
+	req.Retain = req.Expires.Add(s.cfg.Approval.TTL)
+	token := newToken()
+	req.ResultKey = approval.HashToken(token)
+	header, secret := splitCredentials(req.Header)
+	req.Header = header
+	if err := s.pending.Put(req); err != nil {
+		return "", "", err
 	}
+	if req.Response == nil {
+		s.secrets.put(req.ID, secret, req.Expires)
+	}
+	s.notify(webhook.EventCreated, req, "")
+	return req.ID, token, nil
 }
 
 func readBody(r *http.Request, limit int64) ([]byte, error) {
@@ -344,7 +977,25 @@ func readBody(r *http.Request, limit int64) ([]byte, error) {
 		return nil, nil
 	}
 	defer r.Body.Close()
-	limited := io.LimitReader(r.Body, limit+1)
+	return readLimited(r.Body, limit)
+}
+
+// boundedBuffer keeps the first limit bytes written to it and silently
+// drops the rest, so it never fails the writer it is teed from.
+type boundedBuffer struct {
+	data  []byte
+	limit int64
+}
+
+func (b *boundedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - int64(len(b.data)); room > 0 {
+		b.data = append(b.data, p[:min(int64(len(p)), room)]...)
+	}
+	return len(p), nil
+}
+
+func readLimited(body io.Reader, limit int64) ([]byte, error) {
+	limited := io.LimitReader(body, limit+1)
 	data, err := io.ReadAll(limited)
 	if err != nil {
 		return nil, err
@@ -361,6 +1012,17 @@ func writeError(w http.ResponseWriter, code int, message string) {
 	})
 }
 
+func errorResponse(code int, message string) approval.Response {
+	data, _ := json.Marshal(map[string]string{
+		"error": message,
+	})
+	return approval.Response{
+		Status: code,
+		Header: http.Header{"Content-Type": {"application/json"}},
+		Body:   data,
+	}
+}
+
 func writeJSON(w http.ResponseWriter, code int, payload interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(code)
@@ -368,6 +1030,13 @@ func writeJSON(w http.ResponseWriter, code int, payload interface{}) {
 	_, _ = w.Write(data)
 }
 
+func writeHeld(w http.ResponseWriter, held approval.Response) {
+	copyHeaders(w.Header(), held.Header)
+	w.Header().Del("Content-Length")
+	w.WriteHeader(held.Status)
+	_, _ = w.Write(held.Body)
+}
+
 func addForwardedFor(req *http.Request, remoteAddr string) {
 	ip, _, err := net.SplitHostPort(remoteAddr)
 	if err != nil {
@@ -411,11 +1080,35 @@ func removeHopHeaders(header http.Header) {
 	}
 }
 
-func sample(text string) string {
-	if len(text) <= 200 {
+const (
+	sampleBytes  = 200
+	redactWindow = 4096
+)
+
+func newRedactor(cfg config.Redaction) (*redact.Redactor, error) {
+	if cfg.Disabled {
+		return nil, nil
+	}
+	custom := make([]redact.Custom, 0, len(cfg.Custom))
+	for _, detector := range cfg.Custom {
+		custom = append(custom, redact.Custom{Name: detector.Name, Pattern: detector.Pattern})
+	}
+	return redact.New(cfg.Detectors, custom)
+}
+
+func (s *Server) sample(text string) string {
+	return truncate(s.redactor.Apply(truncate(text, redactWindow)), sampleBytes)
+}
+
+func truncate(text string, limit int) string {
+	if len(text) <= limit {
 		return text
 	}
-	return text[:200]
+	cut := limit
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	return text[:cut]
 }
 
 func elapsedMS(start time.Time) int64 {
@@ -0,0 +1,79 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+var sensitiveKeys = map[string]bool{
+	"accesstoken":        true,
+	"apikey":             true,
+	"authorization":      true,
+	"clientsecret":       true,
+	"cookie":             true,
+	"idtoken":            true,
+	"password":           true,
+	"passwd":             true,
+	"privatekey":         true,
+	"proxyauthorization": true,
+	"refreshtoken":       true,
+	"secret":             true,
+	"sessiontoken":       true,
+	"setcookie":          true,
+	"token":              true,
+	"xapikey":            true,
+	"xapprovaltoken":     true,
+	"xgoogapikey":        true,
+}
+
+func isSensitiveKey(key string) bool {
+	key = strings.NewReplacer("-", "", "_", "").Replace(strings.ToLower(key))
+	return sensitiveKeys[key]
+}
+
+func redactHeader(header http.Header) http.Header {
+	out := cloneHeader(header)
+	for key := range out {
+		if isSensitiveKey(key) {
+			out[key] = []string{redacted}
+		}
+	}
+	return out
+}
+
+func redactBody(body []byte) json.RawMessage {
+	var root interface{}
+	if err := json.Unmarshal(body, &root); err != nil {
+		data, _ := json.Marshal(string(body))
+		return data
+	}
+	data, err := json.Marshal(redactValue(root))
+	if err != nil {
+		return json.RawMessage("null")
+	}
+	return data
+}
+
+func redactValue(value interface{}) interface{} {
+	switch val := value.(type) {
+	case map[string]interface{}:
+		for key, child := range val {
+			if isSensitiveKey(key) {
+				val[key] = redacted
+				continue
+			}
+			val[key] = redactValue(child)
+		}
+		return val
+	case []interface{}:
+		for i, child := range val {
+			val[i] = redactValue(child)
+		}
+		return val
+	default:
+		return val
+	}
+}
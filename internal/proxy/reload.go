@@ -0,0 +1,97 @@
+package proxy
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"prompt-injection-firewall/internal/audit"
+	"prompt-injection-firewall/internal/config"
+	"prompt-injection-firewall/internal/policy"
+)
+
+func (s *Server) Config() config.Config {
+	return s.live.Load().cfg
+}
+
+// Swap replaces the live config and policy, keeping the current ones if
+// cfg names an unknown route format or redaction detector.
+func (s *Server) Swap(cfg config.Config, evaluator *policy.Evaluator) error {
+	if err := checkRoutes(cfg.Routes); err != nil {
+		return err
+	}
+	redactor, err := newRedactor(cfg.Redaction)
+	if err != nil {
+		return err
+	}
+	next := *s.live.Load()
+	next.cfg = cfg
+	next.evaluator = evaluator
+	next.notifier = s.newNotifier(cfg)
+	next.redactor = redactor
+	s.live.Store(&next)
+	return nil
+}
+
+func (s *Server) Reload(path string) error {
+	current := s.live.Load()
+	start := time.Now()
+	cfg, err := config.Load(path)
+	var evaluator *policy.Evaluator
+	if err == nil {
+		evaluator, err = policy.Compile(cfg)
+	}
+	if err == nil {
+		err = s.Swap(cfg, evaluator)
+	}
+	if err != nil {
+		var candidate string
+		if data, readErr := os.ReadFile(path); readErr == nil {
+			candidate = config.Version(data)
+		}
+		current.logEvent(audit.Event{
+			Time:             time.Now().Format(current.cfg.TimeFormat),
+			RuleName:         "config_reload",
+			Reason:           "config_reload_failed",
+			Upstream:         current.cfg.Upstream,
+			ElapsedMS:        elapsedMS(start),
+			ErrorString:      err.Error(),
+			CandidateVersion: candidate,
+		})
+		return err
+	}
+	s.live.Load().logEvent(audit.Event{
+		Time:      time.Now().Format(cfg.TimeFormat),
+		RuleName:  "config_reload",
+		Reason:    "config_reloaded",
+		Upstream:  cfg.Upstream,
+		ElapsedMS: elapsedMS(start),
+	})
+	return nil
+}
+
+func (s *Server) WatchConfig(ctx context.Context, path string, interval time.Duration, onReload func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	seen := s.Config().Version
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		version := config.Version(data)
+		if version == seen {
+			continue
+		}
+		seen = version
+		err = s.Reload(path)
+		if onReload != nil {
+			onReload(err)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"prompt-injection-firewall/internal/approval"
+	"prompt-injection-firewall/internal/audit"
+	"prompt-injection-firewall/internal/config"
+	"prompt-injection-firewall/internal/policy"
+	"prompt-injection-firewall/internal/webhook"
+)
+
+const maxResultWait = 5 * time.Minute
+
+type waiters struct {
+	mu    sync.Mutex
+	chans map[string][]chan struct{}
+}
+
+func newWaiters() *waiters {
+	return &waiters{chans: make(map[string][]chan struct{})}
+}
+
+func (w *waiters) subscribe(id string) (<-chan struct{}, func()) {
+	ch := make(chan struct{})
+	w.mu.Lock()
+	w.chans[id] = append(w.chans[id], ch)
+	w.mu.Unlock()
+	return ch, func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		list := w.chans[id]
+		for i, item := range list {
+			if item == ch {
+				list = append(list[:i], list[i+1:]...)
+				break
+			}
+		}
+		if len(list) == 0 {
+			delete(w.chans, id)
+			return
+		}
+		w.chans[id] = list
+	}
+}
+
+func (w *waiters) notify(id string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, ch := range w.chans[id] {
+		close(ch)
+	}
+	delete(w.chans, id)
+}
+
+func (s *Server) handleResult(w http.ResponseWriter, r *http.Request, id string) {
+	var wait time.Duration
+	if raw := r.URL.Query().Get("wait"); raw != "" {
+		parsed, err := time.ParseDuration(raw)
+		if err != nil || parsed < 0 {
+			writeError(w, http.StatusBadRequest, "invalid_wait")
+			return
+		}
+		wait = parsed
+	}
+	if wait > maxResultWait {
+		wait = maxResultWait
+	}
+	pending, ok, err := s.pending.Get(id)
+	if !s.pendingFound(w, ok, err) {
+		return
+	}
+	if !pending.ResultTokenMatches(r.Header.Get("X-Result-Token")) {
+		writeError(w, http.StatusForbidden, "invalid_result_token")
+		return
+	}
+	req, ok, err := s.awaitOutcome(r.Context(), id, wait)
+	if r.Context().Err() != nil {
+		return
+	}
+	if !s.pendingFound(w, ok, err) {
+		return
+	}
+	writeOutcome(w, req)
+}
+
+func (s *Server) awaitOutcome(ctx context.Context, id string, wait time.Duration) (approval.Request, bool, error) {
+	deadline := time.Now().Add(wait)
+	for {
+		ch, cancel := s.waiters.subscribe(id)
+		req, ok, err := s.pending.Get(id)
+		if err != nil || !ok || req.Resolved() {
+			cancel()
+			return req, ok, err
+		}
+		timeout := time.Until(deadline)
+		if req.Status == approval.StatusPending {
+			if untilExpiry := time.Until(req.Expires) + time.Millisecond; untilExpiry < timeout {
+				timeout = untilExpiry
+			}
+		}
+		if timeout <= 0 {
+			cancel()
+			return req, true, nil
+		}
+		timer := time.NewTimer(timeout)
+		select {
+		case <-ch:
+		case <-timer.C:
+		case <-ctx.Done():
+		}
+		timer.Stop()
+		cancel()
+		if ctx.Err() != nil {
+			return req, true, ctx.Err()
+		}
+	}
+}
+
+func writeOutcome(w http.ResponseWriter, req approval.Request) {
+	switch {
+	case req.Status == approval.StatusApproved && req.Result != nil:
+		w.Header().Set("X-Approval-Status", approval.StatusApproved)
+		writeHeld(w, *req.Result)
+	case req.Status == approval.StatusRejected:
+		writeJSON(w, http.StatusForbidden, map[string]string{
+			"error":       "approval_rejected",
+			"approval_id": req.ID,
+			"reason":      req.Comment,
+		})
+	case req.Status == approval.StatusExpired:
+		writeJSON(w, http.StatusGone, map[string]string{
+			"error":       "approval_expired",
+			"approval_id": req.ID,
+		})
+	default:
+		writeJSON(w, http.StatusAccepted, map[string]string{
+			"approval_id": req.ID,
+			"status":      req.Status,
+		})
+	}
+}
+
+// Recover releases approvals that were approved but never got a result,
+// because the process stopped between saving the decision and storing the
+// upstream reply. The upstream request may therefore be sent twice.
+func (s *Server) Recover() {
+	s = s.live.Load()
+	unresolved, err := s.pending.Unresolved()
+	if err != nil {
+		s.logEvent(audit.Event{
+			Time:        time.Now().Format(s.cfg.TimeFormat),
+			RuleName:    "approval_handler",
+			Reason:      "approval_recover_failed",
+			Upstream:    s.cfg.Upstream,
+			ErrorString: err.Error(),
+		})
+		return
+	}
+	for _, req := range unresolved {
+		var who config.Approver
+		var comment string
+		if n := len(req.Votes); n > 0 {
+			last := req.Votes[n-1]
+			who, comment = config.Approver{Name: last.Approver, Roles: last.Roles}, last.Comment
+		}
+		s.release("", req.ID, req, who, comment)
+	}
+}
+
+func (s *Server) RunCleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.live.Load().expire(now)
+		}
+	}
+}
+
+func (s *Server) expire(now time.Time) {
+	expired, err := s.pending.Cleanup(now)
+	if err != nil {
+		s.logEvent(audit.Event{
+			Time:        now.Format(s.cfg.TimeFormat),
+			RuleName:    "approval_handler",
+			Reason:      "approval_cleanup_failed",
+			Upstream:    s.cfg.Upstream,
+			ErrorString: err.Error(),
+		})
+	}
+	s.secrets.prune(now)
+	for _, req := range expired {
+		s.waiters.notify(req.ID)
+		s.notify(webhook.EventExpired, req, "")
+		s.logEvent(audit.Event{
+			Time:       now.Format(s.cfg.TimeFormat),
+			RequestID:  req.RequestID,
+			Method:     req.Method,
+			Path:       req.Path,
+			Stage:      req.Stage,
+			Decision:   string(policy.DecisionDeny),
+			RuleName:   "approval_handler",
+			Reason:     "approval_expired",
+			Upstream:   s.cfg.Upstream,
+			ApprovalID: req.ID,
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+
+	"prompt-injection-firewall/internal/approval"
+	"prompt-injection-firewall/internal/audit"
+	"prompt-injection-firewall/internal/extract"
+	"prompt-injection-firewall/internal/policy"
+)
+
+var errEventTooLarge = errors.New("stream event too large")
+
+func isEventStream(header http.Header) bool {
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	return err == nil && mediaType == "text/event-stream"
+}
+
+func (s *Server) relayStream(w http.ResponseWriter, r *http.Request, resp *http.Response, requestID string, start time.Time, body []byte, requestRule, requestReason, grantID string) {
+	copyHeaders(w.Header(), resp.Header)
+	w.Header().Del("Content-Length")
+	w.WriteHeader(resp.StatusCode)
+	flusher, _ := w.(http.Flusher)
+
+	acc := extract.NewStream(s.cfg.Stream.WindowBytes, s.formatFor(r.URL.Path))
+	acc.LimitToolArgs(int(s.cfg.MaxResponseBytes))
+	reader := bufio.NewReader(resp.Body)
+	decision := policy.DecisionAllow
+	ruleName, reason := requestRule, requestReason
+	var last policy.Result
+	var wouldDecision policy.Decision
+	var wouldRule string
+	bytesOut := 0
+	var streamed []byte
+	var streamErr error
+	for {
+		event, data, err := readEvent(reader, s.cfg.MaxResponseBytes)
+		if err == errEventTooLarge {
+			decision, ruleName, reason = policy.DecisionDeny, "", "response_too_large"
+			n, _ := w.Write(errorEvent(decision, ruleName))
+			bytesOut += n
+			streamErr = err
+			break
+		}
+		if len(event) > 0 {
+			if (s.vault != nil || s.bundle != nil) && int64(len(streamed)+len(event)) <= s.cfg.MaxResponseBytes {
+				streamed = append(streamed, event...)
+			}
+			if len(data) > 0 && !bytes.Equal(data, []byte("[DONE]")) {
+				if addErr := acc.Add(data); addErr == extract.ErrToolArgsTooLarge {
+					decision, ruleName, reason = policy.DecisionDeny, "", "response_too_large"
+					streamErr = addErr
+				} else {
+					res := policy.Result{Decision: policy.DecisionDeny, Reason: "invalid_stream_event"}
+					if addErr == nil {
+						res = s.evaluator.EvaluateResult("response", acc.Result())
+					}
+					res = s.shadow(res)
+					last = res
+					if res.WouldDecision != "" && wouldDecision == "" {
+						wouldDecision, wouldRule = res.WouldDecision, res.WouldRule
+					}
+					if res.Decision != policy.DecisionAllow {
+						decision, ruleName, reason = res.Decision, res.RuleName, res.Reason
+					} else if res.RuleName != "" {
+						ruleName, reason = res.RuleName, res.Reason
+					}
+				}
+			}
+			if decision != policy.DecisionAllow {
+				n, _ := w.Write(errorEvent(decision, ruleName))
+				bytesOut += n
+				break
+			}
+			n, _ := w.Write(event)
+			bytesOut += n
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if err != nil {
+			if err != io.EOF {
+				streamErr = err
+			}
+			break
+		}
+	}
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	s.captureReplay(requestID, "response", r.URL.Path, streamed, true)
+	result := acc.Result()
+	eventDecision := decision
+	if decision == policy.DecisionApprove {
+		eventDecision = policy.DecisionDeny
+		reason = "stream_approval_unsupported"
+	}
+	event := audit.Event{
+		Time:          time.Now().Format(s.cfg.TimeFormat),
+		RequestID:     requestID,
+		RemoteAddr:    r.RemoteAddr,
+		Method:        r.Method,
+		Path:          r.URL.Path,
+		Stage:         "response",
+		Decision:      string(eventDecision),
+		RuleName:      ruleName,
+		Reason:        reason,
+		Score:         last.Score,
+		ScoreRules:    last.ScoreRules(),
+		WouldDecision: string(wouldDecision),
+		WouldRule:     wouldRule,
+		TextSample:    s.sample(result.Text),
+		ToolNames:     result.ToolNames,
+		Upstream:      s.cfg.Upstream,
+		GrantID:       grantID,
+		CaptureID:     s.captureForensic(r, requestID, "response", decision, ruleName, body, &approval.Response{Status: resp.StatusCode, Header: resp.Header, Body: streamed}),
+		ElapsedMS:     elapsedMS(start),
+		BytesIn:       len(body),
+		BytesOut:      bytesOut,
+		StatusCode:    resp.StatusCode,
+	}
+	if streamErr != nil {
+		event.ErrorString = streamErr.Error()
+	}
+	s.logEvent(event)
+}
+
+func readEvent(reader *bufio.Reader, limit int64) ([]byte, []byte, error) {
+	var raw []byte
+	var data [][]byte
+	lineStart := 0
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		raw = append(raw, chunk...)
+		if int64(len(raw)) > limit {
+			return nil, nil, errEventTooLarge
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		line := raw[lineStart:]
+		lineStart = len(raw)
+		trimmed := bytes.TrimRight(line, "\r\n")
+		if len(trimmed) == 0 && len(line) > 0 {
+			return raw, bytes.Join(data, []byte("\n")), nil
+		}
+		if value, ok := bytes.CutPrefix(trimmed, []byte("data:")); ok {
+			data = append(data, bytes.TrimPrefix(value, []byte(" ")))
+		}
+		if err != nil {
+			return raw, bytes.Join(data, []byte("\n")), err
+		}
+	}
+}
+
+func errorEvent(decision policy.Decision, ruleName string) []byte {
+	code := "response_blocked"
+	if decision == policy.DecisionApprove {
+		code = "approval_required"
+	}
+	payload, _ := json.Marshal(map[string]interface{}{
+		"error": map[string]string{
+			"message": "response stream stopped by firewall policy",
+			"type":    "policy_violation",
+			"code":    code,
+			"rule":    ruleName,
+		},
+	})
+	out := []byte("event: error\ndata: ")
+	out = append(out, payload...)
+	return append(out, '\n', '\n')
+}
@@ -0,0 +1,137 @@
+package redact
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+type Custom struct {
+	Name    string `yaml:"name"`
+	Pattern string `yaml:"pattern"`
+}
+
+type Redactor struct {
+	detectors []detector
+}
+
+type detector struct {
+	placeholder string
+	pattern     *regexp.Regexp
+	valid       func(string) bool
+}
+
+var builtins = []struct {
+	name    string
+	pattern string
+	valid   func(string) bool
+}{
+	{"jwt", `eyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]+`, nil},
+	{"api_key", `\b(?:sk-[A-Za-z0-9_-]{16,}|AKIA[0-9A-Z]{16}|gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,}|xox[abposr]-[A-Za-z0-9-]{10,}|AIza[0-9A-Za-z_-]{35}|glpat-[A-Za-z0-9_-]{20,})`, nil},
+	{"email", `[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`, nil},
+	{"credit_card", `\b\d(?:[ -]?\d){12,18}\b`, luhn},
+	{"phone", `\+?\(?\d[\d ().-]{6,}\d`, phone},
+}
+
+var dateLike = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}`)
+
+func Builtins() []string {
+	names := make([]string, 0, len(builtins))
+	for _, b := range builtins {
+		names = append(names, b.name)
+	}
+	return names
+}
+
+func New(names []string, custom []Custom) (*Redactor, error) {
+	if len(names) == 0 {
+		names = Builtins()
+	}
+	enabled := map[string]bool{}
+	for _, name := range names {
+		known := false
+		for _, b := range builtins {
+			known = known || b.name == name
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown redaction detector %q", name)
+		}
+		enabled[name] = true
+	}
+	r := &Redactor{}
+	for _, b := range builtins {
+		if enabled[b.name] {
+			r.detectors = append(r.detectors, detector{placeholder: placeholder(b.name), pattern: regexp.MustCompile(b.pattern), valid: b.valid})
+		}
+	}
+	for _, c := range custom {
+		if c.Name == "" {
+			return nil, fmt.Errorf("custom redaction pattern %q missing name", c.Pattern)
+		}
+		pattern, err := regexp.Compile(c.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("custom redaction %s: %w", c.Name, err)
+		}
+		r.detectors = append(r.detectors, detector{placeholder: placeholder(c.Name), pattern: pattern})
+	}
+	return r, nil
+}
+
+func (r *Redactor) Apply(text string) string {
+	if r == nil {
+		return text
+	}
+	for _, d := range r.detectors {
+		text = d.pattern.ReplaceAllStringFunc(text, func(match string) string {
+			if d.valid != nil && !d.valid(match) {
+				return match
+			}
+			return d.placeholder
+		})
+	}
+	return text
+}
+
+func placeholder(name string) string {
+	return "[" + strings.ToUpper(name) + "]"
+}
+
+func digits(text string) []int {
+	var out []int
+	for _, c := range text {
+		if c >= '0' && c <= '9' {
+			out = append(out, int(c-'0'))
+		}
+	}
+	return out
+}
+
+func luhn(text string) bool {
+	ds := digits(text)
+	if len(ds) < 13 || len(ds) > 19 {
+		return false
+	}
+	sum := 0
+	for i := range ds {
+		d := ds[len(ds)-1-i]
+		if i%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
+
+func phone(text string) bool {
+	if dateLike.MatchString(text) || strings.Count(text, ".") > 2 {
+		return false
+	}
+	n := len(digits(text))
+	if strings.HasPrefix(text, "+") {
+		return n >= 7 && n <= 15
+	}
+	return n >= 9 && n <= 15
+}
@@ -0,0 +1,187 @@
+package replay
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"sort"
+
+	"prompt-injection-firewall/internal/audit"
+	"prompt-injection-firewall/internal/capture"
+	"prompt-injection-firewall/internal/config"
+	"prompt-injection-firewall/internal/policy"
+	"prompt-injection-firewall/internal/proxy"
+)
+
+type Change struct {
+	From       string   `json:"from"`
+	To         string   `json:"to"`
+	Count      int      `json:"count"`
+	RequestIDs []string `json:"request_ids"`
+}
+
+type Report struct {
+	Total       int                       `json:"total"`
+	FromCapture int                       `json:"from_capture"`
+	FromSample  int                       `json:"from_sample"`
+	Changed     int                       `json:"changed"`
+	Matrix      map[string]map[string]int `json:"matrix"`
+	Changes     []Change                  `json:"changes,omitempty"`
+}
+
+type Replayer struct {
+	cfg       config.Config
+	evaluator *policy.Evaluator
+	samples   int
+	bundle    map[string]map[string]capture.Record
+	seen      map[string]bool
+	report    Report
+	changes   map[[2]string]*Change
+}
+
+func New(cfg config.Config, evaluator *policy.Evaluator, samples int) *Replayer {
+	return &Replayer{
+		cfg:       cfg,
+		evaluator: evaluator,
+		samples:   samples,
+		bundle:    make(map[string]map[string]capture.Record),
+		seen:      make(map[string]bool),
+		report:    Report{Matrix: make(map[string]map[string]int)},
+		changes:   make(map[[2]string]*Change),
+	}
+}
+
+func (r *Replayer) LoadBundle(reader io.Reader) error {
+	return capture.Read(reader, func(rec capture.Record) error {
+		stages := r.bundle[rec.RequestID]
+		if stages == nil {
+			stages = make(map[string]capture.Record)
+			r.bundle[rec.RequestID] = stages
+		}
+		stages[rec.Stage] = rec
+		return nil
+	})
+}
+
+func (r *Replayer) Check(reader io.Reader) error {
+	lines := bufio.NewReader(reader)
+	for {
+		line, err := lines.ReadBytes('\n')
+		if len(line) > 0 {
+			var event audit.Event
+			if json.Unmarshal(line, &event) == nil {
+				r.replay(event)
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (r *Replayer) Report() Report {
+	report := r.report
+	report.Changes = nil
+	for _, change := range r.changes {
+		report.Changes = append(report.Changes, *change)
+	}
+	sort.Slice(report.Changes, func(i, j int) bool {
+		a, b := report.Changes[i], report.Changes[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.From+a.To < b.From+b.To
+	})
+	return report
+}
+
+func (r *Replayer) replay(event audit.Event) {
+	from, ok := original(event)
+	if !ok || r.seen[event.RequestID] {
+		return
+	}
+	r.seen[event.RequestID] = true
+	to, captured := r.decide(event)
+	r.report.Total++
+	if captured {
+		r.report.FromCapture++
+	} else {
+		r.report.FromSample++
+	}
+	if r.report.Matrix[from] == nil {
+		r.report.Matrix[from] = make(map[string]int)
+	}
+	r.report.Matrix[from][to]++
+	if from == to {
+		return
+	}
+	r.report.Changed++
+	key := [2]string{from, to}
+	change := r.changes[key]
+	if change == nil {
+		change = &Change{From: from, To: to}
+		r.changes[key] = change
+	}
+	change.Count++
+	if len(change.RequestIDs) < r.samples {
+		change.RequestIDs = append(change.RequestIDs, event.RequestID)
+	}
+}
+
+func (r *Replayer) decide(event audit.Event) (string, bool) {
+	stage := event.Stage
+	if stage == "" {
+		stage = "request"
+	}
+	bodies := r.bundle[event.RequestID]
+	req, ok := bodies["request"]
+	if !ok {
+		return outcome(proxy.EvaluateText(r.cfg, r.evaluator, stage, event.TextSample, event.ToolNames)), false
+	}
+	verdict := outcome(proxy.Evaluate(r.cfg, r.evaluator, "request", req.Path, req.Body))
+	if verdict != string(policy.DecisionAllow) || stage != "response" {
+		return verdict, true
+	}
+	if resp, ok := bodies["response"]; ok && resp.Stream {
+		return outcome(proxy.EvaluateStream(r.cfg, r.evaluator, resp.Path, resp.Body)), true
+	}
+	if resp, ok := bodies["response"]; ok {
+		return outcome(proxy.Evaluate(r.cfg, r.evaluator, "response", resp.Path, resp.Body)), true
+	}
+	return outcome(proxy.EvaluateText(r.cfg, r.evaluator, "response", event.TextSample, event.ToolNames)), false
+}
+
+// outcome is the decision a verdict stands for, counting monitor-mode and
+// dry-run matches as the decision they would have enforced.
+func outcome(verdict proxy.Verdict) string {
+	if verdict.WouldDecision != "" {
+		return verdict.WouldDecision
+	}
+	return verdict.Decision
+}
+
+// original returns the policy decision behind an audit event, skipping
+// events that do not record one and undoing approval-side rewrites and
+// monitor-mode or dry-run shadowing.
+func original(event audit.Event) (string, bool) {
+	if event.RequestID == "" || event.Decision == "" {
+		return "", false
+	}
+	switch event.RuleName {
+	case "approval_handler", "config_reload":
+		return "", false
+	}
+	switch event.Reason {
+	case "body_too_large", "response_too_large":
+		return "", false
+	case "approval_disabled", "approval_store_error", "approval_grant":
+		return string(policy.DecisionApprove), true
+	}
+	if event.WouldDecision != "" {
+		return event.WouldDecision, true
+	}
+	return event.Decision, true
+}
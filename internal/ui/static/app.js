@@ -0,0 +1,215 @@
+(function () {
+  "use strict";
+
+  var pollInterval = 3000;
+  var tokenKey = "pif.approvalToken";
+  var selected = null;
+  var timer = null;
+
+  function $(id) {
+    return document.getElementById(id);
+  }
+
+  function token() {
+    return sessionStorage.getItem(tokenKey) || "";
+  }
+
+  function signedIn() {
+    return sessionStorage.getItem(tokenKey) !== null;
+  }
+
+  function setStatus(message, isError) {
+    var el = $("status");
+    el.textContent = message || "";
+    el.className = isError ? "error" : "";
+  }
+
+  function api(method, path, body) {
+    var options = { method: method, headers: { "X-Approval-Token": token() } };
+    if (body !== undefined) {
+      options.headers["Content-Type"] = "application/json";
+      options.body = JSON.stringify(body);
+    }
+    return fetch("/approvals" + path, options).then(function (resp) {
+      return resp.json().catch(function () {
+        return {};
+      }).then(function (data) {
+        if (!resp.ok && resp.status !== 202) {
+          var err = new Error(data.error || resp.statusText);
+          err.status = resp.status;
+          throw err;
+        }
+        return data;
+      });
+    });
+  }
+
+  function renderSample(el, segments, fallback) {
+    el.textContent = "";
+    if (!segments || segments.length === 0) {
+      el.textContent = fallback || "";
+      return;
+    }
+    segments.forEach(function (segment) {
+      var node = segment.match ? document.createElement("mark") : document.createElement("span");
+      node.textContent = segment.text;
+      el.appendChild(node);
+    });
+  }
+
+  function cell(row, text) {
+    var td = document.createElement("td");
+    td.textContent = text;
+    row.appendChild(td);
+    return td;
+  }
+
+  function renderQueue(items) {
+    var tbody = $("queue");
+    tbody.textContent = "";
+    $("empty").hidden = items.length > 0;
+    items.forEach(function (item) {
+      var row = document.createElement("tr");
+      row.dataset.id = item.id;
+      if (item.id === selected) {
+        row.className = "selected";
+      }
+      cell(row, new Date(item.created).toLocaleTimeString());
+      cell(row, item.rule_name || "");
+      cell(row, (item.tool_names || []).join(", "));
+      renderSample(cell(row, ""), item.sample_segments, item.text_sample);
+      cell(row, (item.approvers || []).length + "/" + (item.quorum || 1));
+      row.addEventListener("click", function () {
+        select(item.id);
+      });
+      tbody.appendChild(row);
+    });
+    if (selected && !items.some(function (item) { return item.id === selected; })) {
+      selected = null;
+      $("detail").hidden = true;
+    }
+  }
+
+  function refresh() {
+    if (!signedIn()) {
+      return;
+    }
+    api("GET", "").then(function (data) {
+      renderQueue(data.approvals || []);
+      setStatus("Updated " + new Date().toLocaleTimeString());
+    }).catch(function (err) {
+      if (err.status === 401) {
+        signOut();
+        setStatus("Invalid token", true);
+        return;
+      }
+      setStatus("Refresh failed: " + err.message, true);
+    });
+  }
+
+  function select(id) {
+    selected = id;
+    api("GET", "/" + encodeURIComponent(id)).then(function (data) {
+      $("detail").hidden = false;
+      $("detail-title").textContent = data.method + " " + data.path;
+      var meta = $("detail-meta");
+      meta.textContent = "";
+      [
+        ["Approval", data.id],
+        ["Request", data.request_id],
+        ["Stage", data.stage],
+        ["Rule", data.rule_name],
+        ["Tools", (data.tool_names || []).join(", ")],
+        ["Approvals", (data.approvers || []).join(", ") + " (" + (data.approvers || []).length + "/" + (data.quorum || 1) + ")"],
+        ["Expires", new Date(data.expires).toLocaleString()]
+      ].forEach(function (pair) {
+        var dt = document.createElement("dt");
+        dt.textContent = pair[0];
+        var dd = document.createElement("dd");
+        dd.textContent = pair[1] || "";
+        meta.appendChild(dt);
+        meta.appendChild(dd);
+      });
+      renderSample($("detail-sample"), data.sample_segments, data.text_sample);
+      $("detail-body").textContent = JSON.stringify(data.body, null, 2);
+      $("comment").value = "";
+      $("grant").checked = false;
+      refresh();
+    }).catch(function (err) {
+      setStatus("Load failed: " + err.message, true);
+    });
+  }
+
+  function decide(action) {
+    if (!selected) {
+      return;
+    }
+    var id = selected;
+    var comment = $("comment").value;
+    var body = action === "reject" ? { reason: comment } : { comment: comment };
+    if (action === "approve" && $("grant").checked) {
+      body.grant = { scope: ["session", "rule"], minutes: parseInt($("grant-minutes").value, 10) || 15 };
+    }
+    api("POST", "/" + encodeURIComponent(id) + "/" + action, body)
+      .then(function (data) {
+        if (data.status === "pending") {
+          setStatus("Approval recorded, waiting for quorum");
+        } else {
+          setStatus(action === "approve" ? "Approved " + id : "Rejected " + id);
+          selected = null;
+          $("detail").hidden = true;
+        }
+        refresh();
+      })
+      .catch(function (err) {
+        setStatus(action + " failed: " + err.message, true);
+      });
+  }
+
+  function signIn(value) {
+    sessionStorage.setItem(tokenKey, value);
+    $("token").hidden = true;
+    $("signin").hidden = true;
+    $("logout").hidden = false;
+    refresh();
+    if (!timer) {
+      timer = setInterval(refresh, pollInterval);
+    }
+  }
+
+  function signOut() {
+    sessionStorage.removeItem(tokenKey);
+    $("token").hidden = false;
+    $("token").value = "";
+    $("signin").hidden = false;
+    $("logout").hidden = true;
+    $("queue").textContent = "";
+    $("detail").hidden = true;
+    selected = null;
+    if (timer) {
+      clearInterval(timer);
+      timer = null;
+    }
+  }
+
+  $("login").addEventListener("submit", function (event) {
+    event.preventDefault();
+    signIn($("token").value);
+  });
+  $("logout").addEventListener("click", signOut);
+  $("approve").addEventListener("click", function () {
+    decide("approve");
+  });
+  $("reject").addEventListener("click", function () {
+    decide("reject");
+  });
+  document.addEventListener("visibilitychange", function () {
+    if (!document.hidden) {
+      refresh();
+    }
+  });
+
+  if (signedIn()) {
+    signIn(token());
+  }
+})();
@@ -0,0 +1,148 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"prompt-injection-firewall/internal/config"
+)
+
+const (
+	EventCreated  = "approval.created"
+	EventApproved = "approval.approved"
+	EventRejected = "approval.rejected"
+	EventExpired  = "approval.expired"
+)
+
+type Payload struct {
+	Event      string    `json:"event"`
+	DeliveryID string    `json:"delivery_id"`
+	ApprovalID string    `json:"approval_id"`
+	RequestID  string    `json:"request_id"`
+	Stage      string    `json:"stage,omitempty"`
+	RuleName   string    `json:"rule_name,omitempty"`
+	ToolNames  []string  `json:"tool_names,omitempty"`
+	TextSample string    `json:"text_sample,omitempty"`
+	Status     string    `json:"status"`
+	Approver   string    `json:"approver,omitempty"`
+	Approvers  []string  `json:"approvers,omitempty"`
+	Comment    string    `json:"comment,omitempty"`
+	Created    time.Time `json:"created"`
+	Expires    time.Time `json:"expires"`
+	ApproveURL string    `json:"approve_url"`
+	RejectURL  string    `json:"reject_url"`
+	DetailURL  string    `json:"detail_url"`
+}
+
+type Notifier struct {
+	hooks   []config.Webhook
+	client  *http.Client
+	backoff time.Duration
+	onFail  func(hook config.Webhook, payload Payload, err error)
+	wg      sync.WaitGroup
+}
+
+func New(hooks []config.Webhook, onFail func(config.Webhook, Payload, error)) *Notifier {
+	return &Notifier{
+		hooks:   hooks,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		backoff: time.Second,
+		onFail:  onFail,
+	}
+}
+
+func (n *Notifier) Send(payload Payload) {
+	if n == nil {
+		return
+	}
+	for _, hook := range n.hooks {
+		if !wants(hook, payload.Event) {
+			continue
+		}
+		n.wg.Add(1)
+		go func(hook config.Webhook) {
+			defer n.wg.Done()
+			if err := n.deliver(hook, payload); err != nil && n.onFail != nil {
+				n.onFail(hook, payload, err)
+			}
+		}(hook)
+	}
+}
+
+func (n *Notifier) Wait() {
+	if n == nil {
+		return
+	}
+	n.wg.Wait()
+}
+
+func (n *Notifier) deliver(hook config.Webhook, payload Payload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	attempts := hook.Retries + 1
+	delay := n.backoff
+	for attempt := 1; ; attempt++ {
+		retry, err := n.post(hook, payload.DeliveryID, body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= attempts {
+			return fmt.Errorf("after %d attempts: %w", attempt, err)
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+func (n *Notifier) post(hook config.Webhook, deliveryID string, body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-PIF-Delivery", deliveryID)
+	req.Header.Set("X-PIF-Timestamp", timestamp)
+	req.Header.Set("X-PIF-Signature", "sha256="+Sign(hook.Secret, timestamp, body))
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+	return retry, fmt.Errorf("webhook returned %d", resp.StatusCode)
+}
+
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func wants(hook config.Webhook, event string) bool {
+	if len(hook.Events) == 0 {
+		return true
+	}
+	for _, name := range hook.Events {
+		if strings.EqualFold(name, event) || strings.EqualFold("approval."+name, event) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,76 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"prompt-injection-firewall/internal/config"
+)
+
+func TestSendSignsAndRetries(t *testing.T) {
+	var mu sync.Mutex
+	attempts := 0
+	var got Payload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		if attempts < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		want := "sha256=" + Sign("s3cret", r.Header.Get("X-PIF-Timestamp"), body)
+		if r.Header.Get("X-PIF-Signature") != want {
+			t.Errorf("bad signature %q", r.Header.Get("X-PIF-Signature"))
+		}
+		_ = json.Unmarshal(body, &got)
+	}))
+	defer server.Close()
+
+	var failures []error
+	n := New([]config.Webhook{{URL: server.URL, Secret: "s3cret", Retries: 3}}, func(_ config.Webhook, _ Payload, err error) {
+		failures = append(failures, err)
+	})
+	n.backoff = time.Millisecond
+	n.Send(Payload{Event: EventCreated, ApprovalID: "abc", RuleName: "approve_tools", ApproveURL: "https://pif/approvals/abc/approve"})
+	n.Wait()
+
+	if attempts != 3 || len(failures) != 0 {
+		t.Fatalf("expected delivery on third attempt, got %d attempts, failures %v", attempts, failures)
+	}
+	if got.ApprovalID != "abc" || got.RuleName != "approve_tools" || !strings.HasSuffix(got.ApproveURL, "/approve") {
+		t.Fatalf("unexpected payload: %+v", got)
+	}
+}
+
+func TestSendReportsPermanentFailure(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	var failures []error
+	hooks := []config.Webhook{
+		{URL: server.URL, Secret: "s", Retries: 3},
+		{URL: server.URL, Secret: "s", Retries: 3, Events: []string{"expired"}},
+	}
+	n := New(hooks, func(_ config.Webhook, _ Payload, err error) {
+		failures = append(failures, err)
+	})
+	n.backoff = time.Millisecond
+	n.Send(Payload{Event: EventRejected})
+	n.Wait()
+
+	if attempts != 1 || len(failures) != 1 {
+		t.Fatalf("expected one attempt and one failure, got %d attempts, failures %v", attempts, failures)
+	}
+}